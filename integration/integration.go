@@ -0,0 +1,271 @@
+//go:build integration
+
+// Command integration runs the whole pipeline of unpack with the tools of the system against fixture archives,
+// which it creates with the same tools, so that changes of the syntax or the behavior of tar, unzip, 7z and unrar
+// across versions and platforms are caught. It is meant to run inside the containers of run.sh, see the Dockerfile.
+//
+//	go build -tags integration -o integration-test ./integration
+//	./integration-test
+//
+// Fixtures whose tools are missing are skipped (e.g. rar archives need the non-free rar to create them).
+// The exit code is 1, if a case failed.
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/metakeule/unpack/unpack.v1"
+)
+
+// tree is the content of the fixture archives: a single top level directory
+var tree = map[string]string{
+	"top/a.txt":            "alpha\n",
+	"top/sub/b.txt":        "beta\n",
+	"top/sub/deeper/c.txt": "gamma\n",
+}
+
+// fixture is an archive that is created by a shell command inside a directory with the tree
+type fixture struct {
+	file string
+	ext  string
+
+	// native is true, if the native backend unpacks the format
+	native bool
+
+	tools []string
+	cmd   string
+}
+
+var fixtures = []fixture{
+	{"fixture.tar", ".tar", true, []string{"tar"}, "tar -cf fixture.tar top"},
+	{"fixture.tar.gz", ".tar.gz", true, []string{"tar", "gzip"}, "tar -czf fixture.tar.gz top"},
+	{"fixture.tgz", ".tgz", true, []string{"tar", "gzip"}, "tar -czf fixture.tgz top"},
+	{"fixture.tar.bz2", ".tar.bz2", true, []string{"tar", "bzip2"}, "tar -cjf fixture.tar.bz2 top"},
+	{"fixture.tar.xz", ".tar.xz", false, []string{"tar", "xz"}, "tar -cJf fixture.tar.xz top"},
+	{"fixture.tar.zst", ".tar.zst", false, []string{"tar", "zstd"}, "tar -cf - top | zstd -q -o fixture.tar.zst"},
+	{"fixture.zip", ".zip", true, []string{"zip", "unzip"}, "zip -qr fixture.zip top"},
+	{"fixture.7z", ".7z", false, []string{"7z"}, "7z a -bd fixture.7z top > /dev/null"},
+	{"fixture.rar", ".rar", false, []string{"rar", "unrar"}, "rar a -idq fixture.rar top"},
+}
+
+// testCase runs the pipeline for the archive file of the fixture f inside dir and returns the produced directory
+type testCase struct {
+	name string
+	run  func(f fixture, file string, dir string) (string, error)
+
+	// want is the produced tree
+	want map[string]string
+
+	// native cases only run for formats of the native backend
+	native bool
+}
+
+var cases = []testCase{
+	{
+		name: "unpack",
+		run: func(f fixture, file string, dir string) (string, error) {
+			return strings.TrimSuffix(file, f.ext), unpack.New(unpack.RemoveArchive).UnpackFile(file)
+		},
+		want: map[string]string{"a.txt": "alpha\n", "sub/b.txt": "beta\n", "sub/deeper/c.txt": "gamma\n"},
+	},
+	{
+		name: "native",
+		run: func(f fixture, file string, dir string) (string, error) {
+			return strings.TrimSuffix(file, f.ext), unpack.New(unpack.RemoveArchive, unpack.Native).UnpackFile(file)
+		},
+		want:   map[string]string{"a.txt": "alpha\n", "sub/b.txt": "beta\n", "sub/deeper/c.txt": "gamma\n"},
+		native: true,
+	},
+	{
+		name: "strip-components",
+		run: func(f fixture, file string, dir string) (string, error) {
+			return strings.TrimSuffix(file, f.ext), unpack.New(unpack.RemoveArchive, unpack.StripComponents(2)).UnpackFile(file)
+		},
+		want: map[string]string{"b.txt": "beta\n", "deeper/c.txt": "gamma\n"},
+	},
+	{
+		name: "exclude",
+		run: func(f fixture, file string, dir string) (string, error) {
+			return strings.TrimSuffix(file, f.ext), unpack.New(unpack.RemoveArchive, unpack.Exclude("b.txt")).UnpackFile(file)
+		},
+		want: map[string]string{"a.txt": "alpha\n", "sub/deeper/c.txt": "gamma\n"},
+	},
+	{
+		name: "extract",
+		run: func(f fixture, file string, dir string) (string, error) {
+			dest := filepath.Join(dir, "dest")
+			return dest, unpack.New().ExtractEntries(file, []string{"top/sub/b.txt"}, dest)
+		},
+		want: map[string]string{"top/sub/b.txt": "beta\n"},
+	},
+	{
+		name: "test",
+		run: func(f fixture, file string, dir string) (string, error) {
+			return "", unpack.New().TestArchive(file)
+		},
+	},
+}
+
+// readTree returns the content of the regular files inside dir by their slash separated paths
+func readTree(dir string) (map[string]string, error) {
+	res := map[string]string{}
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		res[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return res, err
+}
+
+// writeTree writes tree into dir
+func writeTree(dir string) error {
+	for name, content := range tree {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(p, []byte(content), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingTool returns the first of the tools that is not installed
+func missingTool(tools []string) string {
+	for _, t := range tools {
+		if _, err := exec.LookPath(t); err != nil {
+			return t
+		}
+	}
+	return ""
+}
+
+// printVersions prints the first line of the version of each installed tool
+func printVersions() {
+	for _, t := range []string{"tar --version", "gzip --version", "bzip2 --help", "xz --version", "zstd --version", "unzip -v", "zip -v", "7z", "unrar", "rar"} {
+		args := strings.Fields(t)
+		if _, err := exec.LookPath(args[0]); err != nil {
+			fmt.Printf("%-6s not installed\n", args[0])
+			continue
+		}
+
+		out, _ := exec.Command(args[0], args[1:]...).CombinedOutput()
+		for _, line := range strings.Split(string(out), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				fmt.Printf("%-6s %s\n", args[0], line)
+				break
+			}
+		}
+	}
+	fmt.Println()
+}
+
+// runCase creates the fixture f inside a directory of its own below work and runs c with it
+func runCase(work string, f fixture, c testCase) error {
+	dir, err := os.MkdirTemp(work, c.name+"-")
+	if err != nil {
+		return err
+	}
+
+	err = writeTree(dir)
+	if err != nil {
+		return err
+	}
+
+	sh := exec.Command("/bin/sh", "-c", f.cmd)
+	sh.Dir = dir
+	if out, err := sh.CombinedOutput(); err != nil {
+		return fmt.Errorf("creating the fixture failed: %s: %s", err, out)
+	}
+
+	// the tree must not be mistaken for the output
+	err = os.RemoveAll(filepath.Join(dir, "top"))
+	if err != nil {
+		return err
+	}
+
+	out, err := c.run(f, filepath.Join(dir, f.file), dir)
+	if err != nil {
+		return err
+	}
+	if c.want == nil {
+		return nil
+	}
+
+	got, err := readTree(out)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(got, c.want) {
+		return fmt.Errorf("got %s, want %s", describe(got), describe(c.want))
+	}
+	return nil
+}
+
+// describe returns the sorted paths of the tree t
+func describe(t map[string]string) string {
+	var names []string
+	for n := range t {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return "[" + strings.Join(names, " ") + "]"
+}
+
+func main() {
+	printVersions()
+
+	work, err := os.MkdirTemp("", "unpack-integration-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer os.RemoveAll(work)
+
+	var failed int
+	for _, f := range fixtures {
+		missing := missingTool(f.tools)
+
+		for _, c := range cases {
+			label := fmt.Sprintf("%-16s %-16s", f.file, c.name)
+			switch {
+			case missing != "":
+				fmt.Printf("SKIP %s (%s is not installed)\n", label, missing)
+			case c.native && !f.native:
+				fmt.Printf("SKIP %s (no native unpacker)\n", label)
+			default:
+				if err := runCase(work, f, c); err != nil {
+					failed++
+					fmt.Printf("FAIL %s %s\n", label, err)
+				} else {
+					fmt.Printf("ok   %s\n", label)
+				}
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("\n%d failed\n", failed)
+		os.Exit(1)
+	}
+}
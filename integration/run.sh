@@ -0,0 +1,49 @@
+#!/bin/sh
+# Runs the integration tests inside containers with the tools of several distributions (see Dockerfile).
+# Each line of the matrix is "image|packages". Pass an image and its packages to run just that one:
+#
+#   integration/run.sh
+#   integration/run.sh alpine:3.20 "gzip unzip zip"
+#
+# The exit code is 1, if one of the containers failed.
+
+set -u
+
+cd "$(dirname "$0")/.."
+
+matrix="
+debian:bookworm|tar gzip bzip2 xz-utils zstd unzip zip p7zip-full
+debian:bullseye|tar gzip bzip2 xz-utils zstd unzip zip p7zip-full
+ubuntu:24.04|tar gzip bzip2 xz-utils zstd unzip zip p7zip-full
+alpine:3.20|gzip bzip2 xz zstd unzip zip 7zip
+alpine:3.20|tar gzip bzip2 xz zstd unzip zip 7zip
+fedora:40|tar gzip bzip2 xz zstd unzip zip p7zip p7zip-plugins
+"
+
+if [ $# -gt 0 ]; then
+    matrix="$1|${2:-}"
+fi
+
+failed=0
+n=0
+IFS='
+'
+for line in $matrix; do
+    [ -z "$line" ] && continue
+    image="${line%%|*}"
+    packages="${line#*|}"
+    n=$((n + 1))
+    tag="unpack-integration-$n"
+
+    echo "=== $image: $packages"
+    if ! docker build -q -f integration/Dockerfile --build-arg "BASE=$image" --build-arg "PACKAGES=$packages" -t "$tag" . > /dev/null; then
+        echo "FAIL building the image"
+        failed=1
+        continue
+    fi
+
+    docker run --rm "$tag" || failed=1
+    echo
+done
+
+exit $failed
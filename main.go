@@ -1,13 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/metakeule/config"
 	"github.com/metakeule/unpack/unpack.v1"
+	"github.com/metakeule/unpack/unpack.v1/unpackgrpc"
+	"github.com/metakeule/unpack/unpack.v1/unpackhttp"
+	"google.golang.org/grpc"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 var (
@@ -36,17 +53,46 @@ file ending | expected command inside the path
 -----------------------------
 tar         | tar
 tgz         | tar, gzip
+tar.gz      | tar, gzip
+tar.bz2     | tar, bzip2
+tar.xz      | tar, xz
+txz         | tar, xz
+tbz2, tbz   | tar, bzip2
+tar.zst     | tar, zstd
+tzst        | tar, zstd
+tar.lz4     | tar, lz4
+tar.lzma    | tar, xz
+tar.Z       | tar, uncompress
+xz          | xz
+bz2         | bzip2
+zst         | zstd
+lz4         | lz4
+lzma        | xz
+Z           | uncompress
 gz          | gzip
 7z          | 7z
 zip         | unzip
 rar         | unrar
 
+Before unpacking, the integrity of an archive can be checked with the verify command
+(unpack verify myfile.zip) or by passing the --test flag.
+
+Exit codes (e.g. for makefiles, in combination with --quiet):
+0  success
+1  other failure, e.g. the file does not exist or the download failed
+2  unknown format (or no extension)
+3  external tool missing
+4  extraction failed, e.g. a corrupt archive or an exceeded limit
+5  partial batch failure: some archives have been unpacked, others have failed
+6  checksum mismatch or bad signature
+64 invalid arguments
+
 `,
 	)
 
 	fileArg = cfg.NewString(
 		"file",
-		"archive file to be extracted",
+		"archive file to be extracted, may be an URL to download it from (http, https, sftp, ssh, s3, gs, az); may be repeated or comma separated to unpack several archives",
 		config.Shortflag('f'),
 	)
 
@@ -57,8 +103,166 @@ rar         | unrar
 		config.Default(int32(0)),
 	)
 
+	logFileArg = cfg.NewString(
+		"log-file",
+		"file to which the log messages and the output of the commands are appended, by default the errors go to stderr and the rest to stdout",
+	)
+
+	logToArg = cfg.NewString(
+		"log-to",
+		"where the log messages and the output of the commands go: console = stderr and stdout, syslog = local syslog daemon, journald = systemd journal (see --log-file)",
+		config.Default("console"),
+	)
+
+	quietArg = cfg.NewBool(
+		boolFlag("quiet"),
+		"no output at all, only the exit code reports the result",
+		config.Shortflag('q'),
+		config.Default(false),
+	)
+
+	jsonArg = cfg.NewBool(
+		boolFlag("json"),
+		"print the result of each archive (source, dir, files, bytes, duration in seconds, error and its code) as a JSON array to stdout instead of logging",
+		config.Default(false),
+	)
+
+	printDirArg = cfg.NewBool(
+		boolFlag("print-dir"),
+		"print just the absolute path of each created directory to stdout (one per line), e.g. for cd \"$(unpack -f foo.zip --print-dir)\"; logs go to stderr",
+		config.Default(false),
+	)
+
+	print0Arg = cfg.NewBool(
+		boolFlag("print0"),
+		"like --print-dir, but the paths are terminated by a NUL character instead of a newline, e.g. for xargs -0",
+		config.Default(false),
+	)
+
+	eventsArg = cfg.NewString(
+		"events",
+		"write the events of the unpacking (archive started, file extracted, archive done, error) in the given format to stdout (or --events-file) while the archives are unpacked: ndjson = one JSON object per line",
+	)
+
+	eventsFileArg = cfg.NewString(
+		"events-file",
+		"file to which the events of --events are appended instead of stdout",
+	)
+
+	notifyURLArg = cfg.NewString(
+		"notify-url",
+		"webhook to which a JSON object (archive, dir, status, error) is posted whenever an archive has been unpacked or has failed",
+	)
+
+	notifyArg = cfg.NewBool(
+		boolFlag("notify"),
+		"show a desktop notification when a run that took longer than --notify-after has finished or failed (daemon, watch and serve: for every such archive)",
+		config.Default(false),
+	)
+
+	notifyAfterArg = cfg.NewInt32(
+		"notify-after",
+		"minimal duration in seconds of the runs (or archives) that --notify reports",
+		config.Default(int32(10)),
+	)
+
+	rotateSizeArg = cfg.NewString(
+		"rotate-size",
+		"rotate the history, the --events-file and the --log-file when they would grow beyond the given size, e.g. 100M; the rotated files are compressed with gzip",
+	)
+
+	rotateAgeArg = cfg.NewString(
+		"rotate-age",
+		"rotate the history, the --events-file and the --log-file after they have been written to for the given time, e.g. 24h",
+	)
+
+	rotateKeepArg = cfg.NewInt32(
+		"rotate-keep",
+		"number of rotated and compressed files that are kept, 0 = all",
+		config.Default(int32(0)),
+	)
+
+	progressArg = cfg.NewBool(
+		boolFlag("progress"),
+		"show the progress of the extraction in percent (tars are scanned first)",
+		config.Default(false),
+	)
+
+	keepLocationArg = cfg.NewBool(
+		boolFlag("keep-location"),
+		"leave the archive file where it is instead of moving it into the unpacked directory",
+		config.Default(false),
+	)
+
+	inPlaceArg = cfg.NewBool(
+		boolFlag("in-place"),
+		"extract directly into the directory like tar -xf, without creating a directory for the archive",
+		config.Default(false),
+	)
+
+	restoreArg = cfg.NewBool(
+		boolFlag("restore"),
+		"move the archive file back and remove the unpacked directory, if the extraction fails",
+		config.Default(false),
+	)
+
+	noFlattenArg = cfg.NewBool(
+		boolFlag("no-flatten"),
+		"keep a single top level folder of the archive inside the unpacked directory",
+		config.Default(false),
+	)
+
+	flattenDepthArg = cfg.NewInt32(
+		"flatten-depth",
+		"number of levels of single folders that are flattened, 0 = all",
+		config.Default(int32(1)),
+	)
+
+	stripComponentsArg = cfg.NewInt32(
+		"strip-components",
+		"number of leading path elements that are removed from the unpacked entries (like tar --strip-components)",
+	)
+
+	includeArg = cfg.NewString(
+		"include",
+		"comma separated globs of the entries that are unpacked (matching the path or the base name), e.g. *.sql",
+	)
+
+	excludeArg = cfg.NewString(
+		"exclude",
+		"comma separated globs of the entries that are not unpacked, e.g. *.log,node_modules",
+	)
+
+	dirTemplateArg = cfg.NewString(
+		"dir-template",
+		"name of the unpacked directory with the placeholders {name}, {ext}, {date}, {time}, {mtime}, {sha1} and {sha256}, e.g. {name}-{sha1:8}",
+	)
+
+	manifestArg = cfg.NewBool(
+		boolFlag("manifest"),
+		"write MANIFEST.sha256 with the SHA-256 and the size of every extracted file into the created directory",
+		config.Default(false),
+	)
+
+	singleFileArg = cfg.NewBool(
+		boolFlag("single-file"),
+		"put the file that a decompressor produced (e.g. foo from foo.gz) next to the archive instead of into a directory",
+		config.Default(false),
+	)
+
+	forceRootArg = cfg.NewBool(
+		boolFlag("force-root"),
+		"unpack even inside the root or system directories like /usr, /etc or C:\\Windows",
+		config.Default(false),
+	)
+
+	protectedArg = cfg.NewString(
+		"protected",
+		"comma separated directories that are protected in addition to the root and system directories",
+	)
+
 	rmArg = cfg.NewBool(
-		"rm",
+		boolFlag("rm"),
 		"remove the archive file after successful extraction",
 		config.Shortflag('r'),
 		config.Default(false),
@@ -66,150 +270,2177 @@ rar         | unrar
 
 	// __MACOSX
 	rmMACOSXArg = cfg.NewBool(
-		"rmmacosx",
+		boolFlag("rmmacosx"),
 		"remove __MACOSX directories",
 		config.Default(true),
 	)
 
 	rmGitArg = cfg.NewBool(
-		"rmgit",
+		boolFlag("rmgit"),
 		"remove .git directories",
 		config.Default(false),
 	)
 
 	rmSvnArg = cfg.NewBool(
-		"rmsvn",
+		boolFlag("rmsvn"),
 		"remove .svn directories",
 		config.Default(false),
 	)
 
 	dirArg = cfg.NewBool(
-		"dir",
+		boolFlag("dir"),
 		"extract all files in the working directory",
 		config.Shortflag('d'),
 	)
 
+	dirsArg = cfg.NewString(
+		"dirs",
+		"extract all files in the given directories (comma separated), relative paths are relative to the working directory",
+	)
+
 	matchArg = cfg.NewString(
 		"match",
-		"extract all files in the working directory that are matching the pattern (regular expression)",
+		"extract all files in the working directory (or the directories given by --dirs) that are matching the pattern (regular expression)",
 		config.Shortflag('m'),
 	)
-)
 
-func main() {
-	reportError(run())
-}
+	globArg = cfg.NewString(
+		"glob",
+		"extract all files that are matching the shell-style pattern (e.g. '*.zip' or 'downloads/*.tgz') relative to the working directory (or the directories given by --dirs)",
+	)
 
-func run() (err error) {
-	var (
-		wd       string
-		options  []unpack.Option
-		unpacker interface {
-			UnpackFile(string) error
-			UnpackAllFiles(string) map[string]error
-			UnpackFilesMatching(dir string, pattern string) map[string]error
-		}
+	listFormatsArg = cfg.NewBool(
+		boolFlag("list-formats"),
+		"show the known extensions with the commands that unpack them and whether their tools are installed",
+		config.Default(false),
 	)
 
-steps:
-	for jump := 1; err == nil; jump++ {
-		switch jump - 1 {
-		default:
-			break steps
-		// count a number up for each following step
-		case 0:
-			wd, err = os.Getwd()
-		case 1:
-			wd, err = filepath.Abs(wd)
-		case 2:
-			err = cfg.Run()
-		case 3:
-			switch verbosityArg.Get() {
-			case -1:
-				// do nothing, i.e. no logging
-			case 1:
-				options = append(options, unpack.LogInfos)
-			case 2:
-				options = append(options, unpack.LogVerbose)
-			default:
-				// error logging, also == 0
-				options = append(options, unpack.LogErrors)
-			}
-		case 4:
-			if rmdirs := getRmDirs(); len(rmdirs) > 0 {
-				options = append(options, unpack.RemoveDirectories(rmdirs...))
-			}
-		case 5:
-			if rmArg.Get() {
-				options = append(options, unpack.RemoveArchive)
-			}
-		case 6:
-			unpacker = unpack.New(options...)
-		case 7:
-			if matchArg.IsSet() {
-				errs := unpacker.UnpackFilesMatching(wd, matchArg.Get())
-				if len(errs) > 0 {
-					err = &errorMap{errs}
-				}
-				break steps
-			}
-		case 8:
-			if dirArg.Get() {
-				errs := unpacker.UnpackAllFiles(wd)
-				if len(errs) > 0 {
-					err = &errorMap{errs}
-				}
-				break steps
-			}
-		case 9:
-			if !fileArg.IsSet() {
-				err = fmt.Errorf("missing file argument")
-			}
-		case 10:
-			err = unpacker.UnpackFile(fileArg.Get())
-		}
-	}
+	failFastArg = cfg.NewBool(
+		boolFlag("fail-fast"),
+		"stop on the first archive that fails instead of unpacking the remaining archives of --dir, --dirs or --match, e.g. when a missing tool would let all of them fail",
+		config.Default(false),
+	)
 
-	return
-}
+	testArg = cfg.NewBool(
+		boolFlag("test"),
+		"test the integrity of the archive file before moving and extracting it",
+		config.Shortflag('t'),
+		config.Default(false),
+	)
 
-func getRmDirs() (rmdirs []string) {
-	if rmMACOSXArg.Get() {
-		rmdirs = append(rmdirs, "__MACOSX")
-	}
-	if rmGitArg.Get() {
-		rmdirs = append(rmdirs, ".git")
-	}
-	if rmSvnArg.Get() {
-		rmdirs = append(rmdirs, ".svn")
-	}
-	return
-}
+	checksumArg = cfg.NewString(
+		"checksum",
+		"file with the checksum of the archive file (the sha256sum or md5sum output or just the checksum), by default foo.tgz.sha256, foo.tgz.md5 or SHA256SUMS beside foo.tgz are used, if they exist",
+	)
 
-func reportError(err error) {
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR!")
-		if m, ok := err.(*errorMap); ok {
-			m.WriteTo(os.Stderr)
-			return
-		}
+	verifySigArg = cfg.NewString(
+		"verify-sig",
+		"verification of the detached signature beside the archive file (foo.tgz.asc or foo.tgz.sig) with gpg: ignore, verify = verify it if it exists, require = refuse archives without a good signature",
+		config.Default("ignore"),
+	)
 
-		fmt.Fprintln(os.Stderr, err.Error())
-	}
-}
+	keyringArg = cfg.NewString(
+		"keyring",
+		"keyring file with the public keys for --verify-sig (default: the keyring of gpg)",
+	)
 
-type errorMap struct {
-	errs map[string]error
-}
+	nativeArg = cfg.NewBool(
+		boolFlag("native"),
+		"extract .tar, .tgz, .tar.gz, .gz and .zip files without running external commands",
+		config.Default(false),
+	)
 
-func (e *errorMap) WriteTo(w io.Writer) {
-	for k, v := range e.errs {
-		fmt.Fprintf(w, "## %s ##\n%s\n\n", k, v.Error())
-	}
-}
+	securityArg = cfg.NewString(
+		"security",
+		"preset of the safety features: relaxed = trust the archives, standard = relative symlinks and limits against archive bombs, paranoid = no symlinks, no commands and strict limits (the other flags override single settings)",
+		config.Default("relaxed"),
+	)
+
+	symlinksArg = cfg.NewString(
+		"symlinks",
+		"policy for symbolic links inside archives: allow = keep all links, relative = keep only relative links pointing inside the unpacked directory, skip = keep no links",
+		config.Default("allow"),
+	)
+
+	ifExistsArg = cfg.NewString(
+		"if-exists",
+		"what happens if the directory for an archive exists: rename = add a suffix like -1, skip = don't unpack, overwrite = remove the directory, fail = report an error",
+		config.Default("rename"),
+	)
+
+	longPathsArg = cfg.NewString(
+		"long-paths",
+		"what happens to entries whose paths would be too long for the operating system (native backend): ignore, shorten = add a hash suffix, skip, fail",
+		config.Default("ignore"),
+	)
+
+	maxSizeArg = cfg.NewString(
+		"maxsize",
+		"abort the extraction of an archive when more than the given size has been extracted, e.g. 500M or 2G",
+	)
+
+	toolConcurrencyArg = cfg.NewString(
+		"tool-concurrency",
+		"comma separated maximal numbers of commands that run a tool at the same time, e.g. 7z=1,unzip=4",
+	)
+
+	decompressorsArg = cfg.NewString(
+		"decompressors",
+		"comma separated decompressors by format instead of the detected parallel ones, e.g. xz=xz -T0,gzip=gzip",
+	)
+
+	maxCPUArg = cfg.NewInt32(
+		"max-cpu",
+		"maximal number of goroutines that decompress with the native backend at the same time",
+	)
+
+	zipWorkersArg = cfg.NewInt32(
+		"zip-workers",
+		"number of goroutines that extract the files of a zip in parallel (native backend)",
+	)
+
+	maxFilesArg = cfg.NewInt32(
+		"maxfiles",
+		"abort the extraction of an archive when more than the given number of files has been extracted",
+	)
+
+	maxRatioArg = cfg.NewInt32(
+		"maxratio",
+		"abort the extraction of an archive when the extracted size exceeds the given multiple of the archive size",
+	)
+
+	timeoutArg = cfg.NewString(
+		"timeout",
+		"abort the extraction of an archive that takes longer than the given time and kill its command, e.g. 10m",
+	)
+
+	totalTimeoutArg = cfg.NewString(
+		"total-timeout",
+		"abort the running extraction and don't start further ones after the given time, e.g. 1h for a batch of --dir",
+	)
+
+	reproducibleArg = cfg.NewBool(
+		boolFlag("reproducible"),
+		"set the modification time of all extracted files to the newest one inside the archive and keep the access time of the archive",
+		config.Default(false),
+	)
+
+	cacheArg = cfg.NewString(
+		"cache",
+		"directory to cache the content of extracted archives, archives that have been extracted before are taken from the cache",
+	)
+
+	layerArg = cfg.NewString(
+		"layer",
+		"directory in which every archive becomes a layer (e.g. of a container image): it is extracted into a subdirectory named after it without flattening and the archive stays where it is",
+	)
+
+	whiteoutsArg = cfg.NewString(
+		"whiteouts",
+		"format of the whiteouts (.wh.<name>) inside the layers of --layer: metadata = list them in <layer>.whiteouts.json, overlay = overlayfs upper dir (needs root), keep = keep them",
+		config.Default("metadata"),
+	)
+
+	chainArg = cfg.NewInt32(
+		"chain",
+		"maximal number of intermediate archives (e.g. a .tar inside a .gz) that are unpacked in place",
+		config.Default(int32(0)),
+	)
+
+	recursiveArchivesArg = cfg.NewBool(
+		boolFlag("recursive-archives"),
+		"unpack the archives inside of extracted archives too (e.g. zips inside of a zip), see --nesteddepth",
+		config.Default(false),
+	)
+
+	nestedDepthArg = cfg.NewInt32(
+		"nesteddepth",
+		"number of levels of archives inside of archives that are unpacked with --recursive-archives",
+		config.Default(int32(5)),
+	)
+
+	keepDownloadArg = cfg.NewBool(
+		boolFlag("keepdownload"),
+		"keep an archive that has been downloaded from an URL inside the unpacked directory",
+		config.Default(false),
+	)
+
+	stdinArg = cfg.NewBool(
+		boolFlag("stdin"),
+		"extract the archive that is read from stdin, its format must be given by --format",
+		config.Default(false),
+	)
+
+	filesFromArg = cfg.NewString(
+		"files-from",
+		"extract the archive files whose paths are read from the given file or from stdin (-), one per line",
+	)
+
+	nullArg = cfg.NewBool(
+		boolFlag("null"),
+		"the paths of --files-from are terminated by a NUL character instead of a newline, e.g. of find -print0",
+		config.Shortflag('0'),
+		config.Default(false),
+	)
+
+	formatArg = cfg.NewString(
+		"format",
+		"format of the archive that is read from stdin, e.g. tgz, tar.gz or zip",
+	)
+
+	nameArg = cfg.NewString(
+		"name",
+		"name of the directory for the archive that is read from stdin",
+		config.Default("stdin"),
+	)
+
+	scheduleArg = cfg.NewString(
+		"schedule",
+		"cron-like schedule of the daemon, e.g. \"*/10 * * * *\" (every 10 minutes) or \"@every 90s\"",
+		config.Default("*/10 * * * *"),
+	)
+
+	jitterArg = cfg.NewInt32(
+		"jitter",
+		"maximal random delay of the scheduled scans of the daemon in seconds",
+		config.Default(int32(0)),
+	)
+
+	queueFileArg = cfg.NewString(
+		"queue-file",
+		"journal of the queue of the daemon and of watch, so that queued and retried archives survive restarts",
+	)
+
+	retriesArg = cfg.NewInt32(
+		"retries",
+		"number of retries of archives that failed to unpack (daemon and watch), needs --restore",
+		config.Default(int32(0)),
+	)
+
+	backoffArg = cfg.NewInt32(
+		"backoff",
+		"delay of the first retry in seconds, it doubles with every further retry",
+		config.Default(int32(60)),
+	)
+
+	listenArg = cfg.NewString(
+		"listen",
+		"address the server listens on",
+		config.Default(":8080"),
+	)
+
+	metricsArg = cfg.NewBool(
+		boolFlag("metrics"),
+		"expose the number of unpacked archives, failures, bytes and durations for Prometheus at /metrics of --listen (daemon, watch and serve)",
+		config.Default(false),
+	)
+
+	grpcArg = cfg.NewString(
+		"grpc",
+		"address of the gRPC service of serve (e.g. :9090) that streams the progress of the unpacking, see the package unpackgrpc",
+	)
+
+	policyArg = cfg.NewString(
+		"policy",
+		"JSON file with the roles of the clients of the server and the options they may set",
+	)
+
+	historyArg = cfg.NewString(
+		"history",
+		"file of the history of unpacked archives, the daemon always records to it (default: history.jsonl inside the unpack directory of the user configuration)",
+	)
+
+	statsArg = cfg.NewBool(
+		boolFlag("stats"),
+		"accumulate local statistics of the unpacked archives (counts per format, bytes, failures) in --stats-file, see the stats command; nothing is sent anywhere",
+		config.Default(false),
+	)
+
+	statsFileArg = cfg.NewString(
+		"stats-file",
+		"file of the statistics of unpacked archives (default: stats.json inside the unpack directory of the user configuration)",
+	)
+
+	statusArg = cfg.NewString(
+		"status",
+		"show only the history entries with the given status: ok or failed",
+	)
 
-func (e *errorMap) Error() string {
-	var bf bytes.Buffer
-	e.WriteTo(&bf)
-	return bf.String()
+	sinceArg = cfg.NewString(
+		"since",
+		"show only the history entries since the given date (2006-01-02 or RFC 3339)",
+	)
+
+	archiveArg = cfg.NewString(
+		"archive",
+		"show only the history entries of archives whose path contains the given string",
+	)
+
+	catalogArg = cfg.NewString(
+		"catalog",
+		"file of the catalog of archive entries (default: catalog.jsonl inside the unpack directory of the user configuration)",
+	)
+
+	extractArg = cfg.NewBool(
+		boolFlag("extract"),
+		"extract the found entries into subdirectories named after their archives",
+		config.Default(false),
+	)
+
+	destArg = cfg.NewString(
+		"dest",
+		"directory into which the found entries are extracted (default: the working directory)",
+	)
+
+	// globalFlags are the flags of unpack itself. The commands skip all of them but the ones they take, see command,
+	// so a new flag has to be added here.
+	globalFlags = []string{
+		"file", "verbose", "log-file", "log-to", "quiet", "json", "print-dir", "print0", "events", "events-file",
+		"notify-url", "notify", "notify-after", "rotate-size", "rotate-age", "rotate-keep", "progress", "keep-location",
+		"in-place", "restore", "no-flatten", "flatten-depth", "strip-components", "include", "exclude", "dir-template",
+		"manifest", "single-file", "force-root", "protected", "rm", "rmmacosx", "rmgit", "rmsvn", "dir", "dirs", "match",
+		"glob", "list-formats", "fail-fast", "test", "checksum", "verify-sig", "keyring", "native", "security",
+		"symlinks", "if-exists", "long-paths", "maxsize", "tool-concurrency", "decompressors", "max-cpu", "zip-workers",
+		"maxfiles", "maxratio", "timeout", "total-timeout", "reproducible", "cache", "layer", "whiteouts", "chain",
+		"recursive-archives", "nesteddepth", "keepdownload", "stdin", "files-from", "null", "format", "name", "schedule",
+		"jitter", "queue-file", "retries", "backoff", "listen", "metrics", "grpc", "policy", "history", "stats",
+		"stats-file", "status", "since", "archive", "catalog", "extract", "dest",
+	}
+
+	verifyCmd = command(
+		"verify",
+		"test the integrity of an archive file without extracting it, e.g. unpack verify backup.zip",
+		"file", "verbose", "log-file", "log-to", "quiet", "checksum", "verify-sig", "keyring",
+	)
+
+	daemonCmd = command(
+		"daemon",
+		"scan the working directory (or the directories given by --dirs) as given by --schedule and unpack all archives inside of them",
+		"verbose", "log-file", "log-to", "quiet", "events", "events-file", "notify-url", "notify", "notify-after",
+		"rotate-size", "rotate-age", "rotate-keep", "progress", "keep-location", "in-place", "restore", "no-flatten",
+		"flatten-depth", "strip-components", "include", "exclude", "dir-template", "manifest", "single-file",
+		"force-root", "protected", "rm", "rmmacosx", "rmgit", "rmsvn", "dirs", "match", "test", "checksum", "verify-sig",
+		"keyring", "native", "security", "symlinks", "if-exists", "long-paths", "maxsize", "tool-concurrency",
+		"decompressors", "max-cpu", "zip-workers", "maxfiles", "maxratio", "timeout", "reproducible", "cache", "layer",
+		"whiteouts", "chain", "recursive-archives", "nesteddepth", "schedule", "jitter", "queue-file", "retries",
+		"backoff", "listen", "metrics", "history", "stats", "stats-file",
+	)
+
+	watchCmd = command(
+		"watch",
+		"watch a directory (by default the working directory or the directories given by --dirs) and unpack the archives that appear inside of it as soon as they are completely written",
+		"verbose", "log-file", "log-to", "quiet", "events", "events-file", "notify-url", "notify", "notify-after",
+		"rotate-size", "rotate-age", "rotate-keep", "progress", "keep-location", "in-place", "restore", "no-flatten",
+		"flatten-depth", "strip-components", "include", "exclude", "dir-template", "manifest", "single-file",
+		"force-root", "protected", "rm", "rmmacosx", "rmgit", "rmsvn", "dirs", "match", "test", "checksum", "verify-sig",
+		"keyring", "native", "security", "symlinks", "if-exists", "long-paths", "maxsize", "tool-concurrency",
+		"decompressors", "max-cpu", "zip-workers", "maxfiles", "maxratio", "timeout", "reproducible", "cache", "layer",
+		"whiteouts", "chain", "recursive-archives", "nesteddepth", "queue-file", "retries", "backoff", "listen",
+		"metrics", "history", "stats", "stats-file",
+	)
+
+	serveCmd = command(
+		"serve",
+		"serve POST /unpack (JSON naming a path or URL), /upload (multipart upload) and /jobs (both asynchronously, poll GET /jobs/{id}, fetch GET /jobs/{id}/tar) and the gRPC service at --grpc, restricted to the working directory (or the directories given by --dirs)",
+		"verbose", "log-file", "log-to", "quiet", "events", "events-file", "notify-url", "notify", "notify-after",
+		"rotate-size", "rotate-age", "rotate-keep", "progress", "keep-location", "in-place", "restore", "no-flatten",
+		"flatten-depth", "strip-components", "include", "exclude", "dir-template", "manifest", "single-file",
+		"force-root", "protected", "rm", "rmmacosx", "rmgit", "rmsvn", "dirs", "test", "checksum", "verify-sig",
+		"keyring", "native", "security", "symlinks", "if-exists", "long-paths", "maxsize", "tool-concurrency",
+		"decompressors", "max-cpu", "zip-workers", "maxfiles", "maxratio", "timeout", "reproducible", "cache", "layer",
+		"whiteouts", "chain", "recursive-archives", "nesteddepth", "listen", "metrics", "grpc", "policy", "history",
+		"stats", "stats-file",
+	)
+
+	historyCmd = command(
+		"history",
+		"show when archives have been unpacked and where",
+		"verbose", "quiet", "history", "status", "since", "archive",
+	)
+
+	statsCmd = command(
+		"stats",
+		"show the statistics of the unpacked archives that have been recorded with --stats",
+		"verbose", "quiet", "stats-file",
+	)
+
+	catalogCmd = command(
+		"catalog",
+		"list the entries of the archive file (or of all archives inside the working directory or the directories given by --dirs) into the catalog, without extracting them",
+		"file", "verbose", "quiet", "dir", "dirs", "catalog",
+	)
+
+	findCmd = command(
+		"find",
+		"show the archives of the catalog that contain entries matching the pattern, e.g. unpack find '*.pdf'",
+		"verbose", "log-file", "log-to", "quiet", "strip-components", "include", "exclude", "force-root", "protected",
+		"security", "symlinks", "long-paths", "maxsize", "max-cpu", "zip-workers", "maxfiles", "maxratio", "timeout",
+		"catalog", "extract", "dest",
+	)
+
+	extractCmd = command(
+		"extract",
+		"extract only the given entries of the archive file into the working directory (or --dest), e.g. unpack extract backup.zip db/dump.sql docs",
+		"file", "verbose", "log-file", "log-to", "quiet", "strip-components", "include", "exclude", "force-root",
+		"protected", "test", "checksum", "verify-sig", "keyring", "security", "symlinks", "long-paths", "maxsize",
+		"tool-concurrency", "decompressors", "max-cpu", "zip-workers", "maxfiles", "maxratio", "timeout", "dest",
+	)
+
+	watchDirArg = watchCmd.LastString(
+		"directory",
+		"directory to watch, e.g. ~/Downloads",
+	)
+
+	patternArg = findCmd.LastString(
+		"pattern",
+		"pattern of the entry names or base names (see path.Match)",
+		config.Required,
+	)
+
+	catCmd = command(
+		"cat",
+		"write the content of an entry of the archive file to stdout, e.g. unpack cat backup.tgz etc/config.yml | less",
+		"file", "verbose", "quiet",
+	)
+
+	doctorCmd = command(
+		"doctor",
+		"check that the tools of all registered unpackers are installed and can be run, show their versions and how to install the missing ones",
+		"verbose", "quiet",
+	)
+
+	infoCmd = command(
+		"info",
+		"show the format, the number of entries, the compressed and uncompressed size and the top level layout of the archive file, e.g. unpack info backup.tgz",
+		"file", "verbose", "quiet",
+	)
+)
+
+// exit codes, so that scripts can branch on the class of the failure
+const (
+	exitOK = 0
+
+	// exitFailed is the code of failures that are not about the archive, e.g. a missing file or a failed download
+	exitFailed = 1
+
+	exitUnknownFormat    = 2
+	exitToolMissing      = 3
+	exitExtractionFailed = 4
+
+	// exitPartial is the code of batches where some archives have been unpacked and others have failed
+	exitPartial = 5
+
+	exitChecksumMismatch = 6
+
+	// exitUsage is the code of invalid arguments (EX_USAGE of sysexits.h)
+	exitUsage = 64
+)
+
+func main() {
+	start := time.Now()
+	err := run()
+	switch {
+	case quietArg.Get():
+	case jsonArg.Get() && exitCode(err) != exitUsage:
+		printResults(err)
+	default:
+		reportError(err)
+	}
+	notifyRun(err, time.Since(start))
+	os.Exit(exitCode(err))
+}
+
+// archivesDone is the number of archives that have been unpacked or have failed
+var archivesDone int64
+
+// deadline is the end of the run that is given by --total-timeout
+var deadline time.Time
+
+// notifyRun shows a desktop notification for the run, if --notify is set and the run took long enough.
+// The daemon, watch and serve notify for every archive instead.
+func notifyRun(err error, d time.Duration) {
+	n := atomic.LoadInt64(&archivesDone)
+	if !notifyArg.Get() || n == 0 || d < time.Duration(notifyAfterArg.Get())*time.Second {
+		return
+	}
+
+	switch cfg.ActiveCommand() {
+	case daemonCmd, watchCmd, serveCmd:
+		return
+	}
+
+	title, message := "unpack finished", fmt.Sprintf("unpacked %d archive(s) in %s", n, d.Round(time.Second))
+	if err != nil {
+		title, message = "unpack failed", err.Error()
+		if b, ok := err.(*unpack.BatchError); ok {
+			message = b.Footer()
+		}
+	}
+
+	if err := unpack.DesktopNotify(title, message); err != nil && !quietArg.Get() {
+		fmt.Fprintln(os.Stderr, "can't show desktop notification: "+err.Error())
+	}
+}
+
+// usageError is an error of the invocation, as opposed to an error while extracting
+type usageError struct {
+	error
+}
+
+func exitCode(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return exitOK
+	case usageError:
+		return exitUsage
+	case missingToolsError:
+		return exitToolMissing
+	case *unpack.BatchError:
+		if e.Partial() {
+			return exitPartial
+		}
+
+		// all archives have failed, the class is only reported if it is the same for all of them
+		code := -1
+		for _, err := range e.Errors {
+			c := failureCode(err.Err)
+			if code >= 0 && c != code {
+				return exitExtractionFailed
+			}
+			code = c
+		}
+		return code
+	default:
+		return failureCode(err)
+	}
+}
+
+// failureCode returns the exit code of the class of the error of an archive
+func failureCode(err error) int {
+	if unpack.MissingTool(err) != "" {
+		return exitToolMissing
+	}
+
+	switch unpack.ErrorCode(err) {
+	case unpack.CodeUnknownFormat, unpack.CodeNoExtension:
+		return exitUnknownFormat
+	case unpack.CodeNoExec:
+		return exitToolMissing
+	case unpack.CodeChecksumMismatch, unpack.CodeBadSignature:
+		return exitChecksumMismatch
+	case unpack.CodeCorruptArchive, unpack.CodeCommandFailed, unpack.CodeIllegalPath, unpack.CodeLongPath,
+		unpack.CodeLimitExceeded, unpack.CodeTimeout, unpack.CodeMissingVolume, unpack.CodeClassMismatch:
+		return exitExtractionFailed
+	default:
+		return exitFailed
+	}
+}
+
+func run() (err error) {
+	var (
+		wd       string
+		options  []unpack.Option
+		unpacker interface {
+			TestArchive(string) error
+			UnpackFile(string) error
+			UnpackReader(r io.Reader, format string, destDir string) error
+			UnpackAllFiles(string) map[string]error
+			UnpackFilesMatching(dir string, pattern string) map[string]error
+			UnpackFilesGlob(dir string, pattern string) map[string]error
+			ExtractEntries(file string, paths []string, dest string) error
+		}
+	)
+
+steps:
+	for jump := 1; err == nil; jump++ {
+		switch jump - 1 {
+		default:
+			break steps
+		// count a number up for each following step
+		case 0:
+			wd, err = os.Getwd()
+		case 1:
+			wd, err = filepath.Abs(wd)
+		case 2:
+			takeFiles()
+			if err = applyRC(wd); err != nil {
+				err = usageError{err}
+				break
+			}
+			if err = cfg.Run(); err != nil {
+				err = usageError{err}
+			}
+		case 3:
+			if quietArg.Get() || (jsonArg.Get() && !logFileArg.IsSet() && logToArg.Get() == "console") {
+				// no logging at all, stdout is taken by the results of --json
+				break
+			}
+			switch verbosityArg.Get() {
+			case -1:
+				// do nothing, i.e. no logging
+			case 1:
+				options = append(options, unpack.LogInfos)
+			case 2:
+				options = append(options, unpack.LogVerbose)
+			default:
+				// error logging, also == 0
+				options = append(options, unpack.LogErrors)
+			}
+			if logFileArg.IsSet() && logToArg.Get() != "console" {
+				err = usageError{fmt.Errorf("--log-file can't be combined with --log-to=%s", logToArg.Get())}
+				break
+			}
+			switch logToArg.Get() {
+			case "console":
+			case "syslog":
+				var l *unpack.SyslogLogger
+				if l, err = unpack.NewSyslogLogger("unpack"); err != nil {
+					break
+				}
+				defer l.Close()
+				options = append(options, unpack.WithLogger(l))
+			case "journald":
+				var l *unpack.JournalLogger
+				if l, err = unpack.NewJournalLogger("unpack"); err != nil {
+					break
+				}
+				defer l.Close()
+				options = append(options, unpack.WithLogger(l))
+			default:
+				err = usageError{fmt.Errorf("invalid value for log-to: %#v", logToArg.Get())}
+			}
+			if err != nil || logToArg.Get() != "console" {
+				break
+			}
+			if !logFileArg.IsSet() {
+				// errors must not mix with piped output
+				if printDirArg.Get() || print0Arg.Get() {
+					// stdout is taken by the created directories
+					options = append(options, unpack.LogTo(os.Stderr, os.Stderr, os.Stderr))
+					break
+				}
+				options = append(options, unpack.LogTo(os.Stderr, os.Stdout, os.Stdout))
+				break
+			}
+			var rotation unpack.Rotation
+			if rotation, err = getRotation(); err != nil {
+				break
+			}
+			var f *unpack.RotatingFile
+			if f, err = unpack.OpenRotatingFile(logFileArg.Get(), rotation); err != nil {
+				break
+			}
+			defer f.Close()
+			options = append(options, unpack.LogTo(f, f, f))
+		case 4:
+			if rmdirs := getRmDirs(); len(rmdirs) > 0 {
+				options = append(options, unpack.RemoveDirectories(rmdirs...))
+			}
+		case 5:
+			if securityArg.IsSet() {
+				var preset unpack.SecurityPreset
+				if preset, err = unpack.ParseSecurityPreset(securityArg.Get()); err != nil {
+					err = usageError{err}
+					break
+				}
+				options = append(options, unpack.SecurityLevel(preset))
+			}
+			if rmArg.Get() {
+				options = append(options, unpack.RemoveArchive)
+			}
+			if noFlattenArg.Get() {
+				options = append(options, unpack.NoFlatten)
+			}
+			if flattenDepthArg.IsSet() {
+				options = append(options, unpack.FlattenDepth(int(flattenDepthArg.Get())))
+			}
+			if stripComponentsArg.IsSet() {
+				options = append(options, unpack.StripComponents(int(stripComponentsArg.Get())))
+			}
+			if includeArg.IsSet() {
+				globs := strings.Split(includeArg.Get(), ",")
+				if err = unpack.CheckGlobs(globs...); err != nil {
+					err = usageError{err}
+					break
+				}
+				options = append(options, unpack.Include(globs...))
+			}
+			if excludeArg.IsSet() {
+				globs := strings.Split(excludeArg.Get(), ",")
+				if err = unpack.CheckGlobs(globs...); err != nil {
+					err = usageError{err}
+					break
+				}
+				options = append(options, unpack.Exclude(globs...))
+			}
+			if dirTemplateArg.IsSet() {
+				if err = unpack.CheckDirTemplate(dirTemplateArg.Get()); err != nil {
+					err = usageError{err}
+					break
+				}
+				options = append(options, unpack.DirNameTemplate(dirTemplateArg.Get()))
+			}
+			if singleFileArg.Get() {
+				options = append(options, unpack.SingleFile)
+			}
+			if manifestArg.Get() {
+				options = append(options, unpack.WriteManifest)
+			}
+			if forceRootArg.Get() {
+				options = append(options, unpack.ForceRoot)
+			}
+			if protectedArg.IsSet() {
+				options = append(options, unpack.ProtectedDirs(strings.Split(protectedArg.Get(), ",")...))
+			}
+			if keepLocationArg.Get() {
+				options = append(options, unpack.KeepArchiveInPlace)
+			}
+			if progressArg.Get() && !quietArg.Get() {
+				options = append(options, unpack.PreScan, unpack.OnProgress(showProgress))
+			}
+			if inPlaceArg.Get() {
+				options = append(options, unpack.ExtractHere)
+			}
+			if restoreArg.Get() {
+				options = append(options, unpack.RestoreOnError)
+			}
+			if jsonArg.Get() {
+				options = append(options, unpack.OnDone(addResult))
+			}
+			if printDirArg.Get() || print0Arg.Get() {
+				if jsonArg.Get() {
+					err = usageError{fmt.Errorf("--print-dir and --print0 can't be combined with --json")}
+					break
+				}
+				options = append(options, unpack.OnDone(printDir))
+			}
+		case 6:
+			options = append(options, unpack.VerifyChecksum(checksumArg.Get()))
+			switch verifySigArg.Get() {
+			case "ignore":
+			case "verify":
+				options = append(options, unpack.VerifySignature(unpack.SignaturesVerify, keyringArg.Get()))
+			case "require":
+				options = append(options, unpack.VerifySignature(unpack.SignaturesRequire, keyringArg.Get()))
+			default:
+				err = usageError{fmt.Errorf("invalid value for verify-sig: %#v", verifySigArg.Get())}
+			}
+			if testArg.Get() {
+				options = append(options, unpack.TestBeforeUnpack)
+			}
+			if failFastArg.Get() {
+				options = append(options, unpack.BatchErrorPolicy(unpack.FailFast))
+			}
+			if nativeArg.Get() {
+				options = append(options, unpack.Native)
+			}
+			// the default must not override the security level
+			if symlinksArg.IsSet() {
+				switch symlinksArg.Get() {
+				case "allow":
+					options = append(options, unpack.Symlinks(unpack.SymlinksAllow))
+				case "relative":
+					options = append(options, unpack.Symlinks(unpack.SymlinksRelativeOnly))
+				case "skip":
+					options = append(options, unpack.Symlinks(unpack.SymlinksSkip))
+				default:
+					err = usageError{fmt.Errorf("invalid value for symlinks: %#v", symlinksArg.Get())}
+				}
+			}
+			switch ifExistsArg.Get() {
+			case "rename":
+			case "skip":
+				options = append(options, unpack.OverwritePolicy(unpack.IfExistsSkip))
+			case "overwrite":
+				options = append(options, unpack.OverwritePolicy(unpack.IfExistsOverwrite))
+			case "fail":
+				options = append(options, unpack.OverwritePolicy(unpack.IfExistsFail))
+			default:
+				err = usageError{fmt.Errorf("invalid value for if-exists: %#v", ifExistsArg.Get())}
+			}
+			switch longPathsArg.Get() {
+			case "ignore":
+			case "shorten":
+				options = append(options, unpack.LongPaths(unpack.LongPathsShorten))
+			case "skip":
+				options = append(options, unpack.LongPaths(unpack.LongPathsSkip))
+			case "fail":
+				options = append(options, unpack.LongPaths(unpack.LongPathsFail))
+			default:
+				err = usageError{fmt.Errorf("invalid value for long-paths: %#v", longPathsArg.Get())}
+			}
+		case 7:
+			var limits []unpack.Option
+			if limits, err = limitOptions(maxSizeArg, toolConcurrencyArg, decompressorsArg); err != nil {
+				break
+			}
+			options = append(options, limits...)
+			if maxCPUArg.IsSet() {
+				options = append(options, unpack.MaxCPU(int(maxCPUArg.Get())))
+			}
+			if zipWorkersArg.IsSet() {
+				options = append(options, unpack.ZipConcurrency(int(zipWorkersArg.Get())))
+			}
+			if maxFilesArg.IsSet() {
+				options = append(options, unpack.MaxFileCount(int64(maxFilesArg.Get())))
+			}
+			if maxRatioArg.IsSet() {
+				options = append(options, unpack.MaxCompressionRatio(float64(maxRatioArg.Get())))
+			}
+			if timeoutArg.IsSet() {
+				var d time.Duration
+				d, err = time.ParseDuration(timeoutArg.Get())
+				if err != nil || d <= 0 {
+					err = usageError{fmt.Errorf("invalid value for timeout: %#v", timeoutArg.Get())}
+					break
+				}
+				options = append(options, unpack.Timeout(d))
+			}
+			if totalTimeoutArg.IsSet() {
+				var d time.Duration
+				d, err = time.ParseDuration(totalTimeoutArg.Get())
+				if err != nil || d <= 0 {
+					err = usageError{fmt.Errorf("invalid value for total-timeout: %#v", totalTimeoutArg.Get())}
+					break
+				}
+				deadline = time.Now().Add(d)
+				options = append(options, unpack.Deadline(deadline))
+			}
+			if reproducibleArg.Get() {
+				options = append(options, unpack.Reproducible)
+			}
+			if cacheArg.IsSet() {
+				options = append(options, unpack.Cache(cacheArg.Get()))
+			}
+			if layerArg.IsSet() {
+				options = append(options, unpack.LayerOutput(layerArg.Get()))
+				switch whiteoutsArg.Get() {
+				case "metadata":
+					options = append(options, unpack.LayerWhiteouts(unpack.WhiteoutsMetadata))
+				case "overlay":
+					options = append(options, unpack.LayerWhiteouts(unpack.WhiteoutsOverlay))
+				case "keep":
+					options = append(options, unpack.LayerWhiteouts(unpack.WhiteoutsKeep))
+				default:
+					err = usageError{fmt.Errorf("invalid value for whiteouts: %#v", whiteoutsArg.Get())}
+				}
+				if err != nil {
+					break
+				}
+			}
+			if chainArg.Get() > 0 {
+				options = append(options, unpack.Chain(int(chainArg.Get())))
+			}
+			if keepDownloadArg.Get() {
+				options = append(options, unpack.KeepDownload)
+			}
+			if recursiveArchivesArg.Get() {
+				options = append(options, unpack.NestedDepth(int(nestedDepthArg.Get())))
+			}
+			if eventsArg.IsSet() {
+				var rotation unpack.Rotation
+				if rotation, err = getRotation(); err != nil {
+					break
+				}
+				if eventsArg.Get() != "ndjson" {
+					err = usageError{fmt.Errorf("invalid value for events: %#v", eventsArg.Get())}
+					break
+				}
+				w := io.Writer(os.Stdout)
+				if eventsFileArg.IsSet() {
+					var f *unpack.RotatingFile
+					if f, err = unpack.OpenRotatingFile(eventsFileArg.Get(), rotation); err != nil {
+						break
+					}
+					defer f.Close()
+					w = f
+				} else if jsonArg.Get() {
+					// stdout is taken by the results
+					err = usageError{fmt.Errorf("--events needs --events-file when combined with --json")}
+					break
+				} else if printDirArg.Get() || print0Arg.Get() {
+					// stdout is taken by the created directories
+					err = usageError{fmt.Errorf("--events needs --events-file when combined with --print-dir or --print0")}
+					break
+				}
+				options = append(options, unpack.WriteEvents(w))
+			}
+			if notifyURLArg.IsSet() {
+				options = append(options, unpack.NotifyURL(notifyURLArg.Get()))
+			}
+			if notifyArg.Get() {
+				switch cfg.ActiveCommand() {
+				case daemonCmd, watchCmd, serveCmd:
+					options = append(options, unpack.NotifyDesktop(time.Duration(notifyAfterArg.Get())*time.Second))
+				}
+			}
+			options = append(options, unpack.OnDone(func(unpack.Job) {
+				atomic.AddInt64(&archivesDone, 1)
+			}))
+		case 8:
+			if cfg.ActiveCommand() == historyCmd {
+				err = showHistory()
+				break steps
+			}
+			if historyArg.IsSet() || cfg.ActiveCommand() == daemonCmd || cfg.ActiveCommand() == watchCmd {
+				var h *unpack.History
+				h, err = openHistory()
+				options = append(options, unpack.RecordHistory(h))
+			}
+			if cfg.ActiveCommand() == statsCmd {
+				err = showStats()
+				break steps
+			}
+			if cfg.ActiveCommand() == doctorCmd {
+				err = runDoctor()
+				break steps
+			}
+			if listFormatsArg.Get() {
+				listFormats()
+				break steps
+			}
+			if statsArg.Get() {
+				var s *unpack.StatsFile
+				if s, err = openStats(); err != nil {
+					break
+				}
+				options = append(options, unpack.RecordStats(s))
+			}
+			if metricsArg.Get() {
+				options = append(options, unpack.RecordMetrics(metrics))
+			}
+		case 9:
+			if cfg.ActiveCommand() == catalogCmd {
+				err = runCatalog(wd)
+				break steps
+			}
+			if cfg.ActiveCommand() == findCmd {
+				err = findInCatalog(wd, options)
+				break steps
+			}
+			if cfg.ActiveCommand() == catCmd {
+				err = catEntry()
+				break steps
+			}
+			if cfg.ActiveCommand() == infoCmd {
+				err = showInfo()
+				break steps
+			}
+		case 10:
+			unpacker = unpack.New(options...)
+		case 11:
+			if cfg.ActiveCommand() == verifyCmd {
+				var (
+					archive string
+					rest    []string
+				)
+				archive, rest, err = commandArgs()
+				if err == nil && len(rest) > 0 {
+					err = usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))}
+				}
+				if err == nil {
+					err = unpacker.TestArchive(archive)
+				}
+				break steps
+			}
+			if cfg.ActiveCommand() == extractCmd {
+				var (
+					archive string
+					paths   []string
+				)
+				archive, paths, err = commandArgs()
+				if err != nil {
+					break steps
+				}
+				// the paths may also be comma separated
+				paths = splitFiles(strings.Join(paths, ","))
+				if len(paths) == 0 {
+					err = usageError{fmt.Errorf("missing paths of the entries")}
+					break steps
+				}
+				dest := wd
+				if destArg.IsSet() {
+					dest = destArg.Get()
+					if !filepath.IsAbs(dest) {
+						dest = filepath.Join(wd, dest)
+					}
+				}
+				err = unpacker.ExtractEntries(archive, paths, dest)
+				break steps
+			}
+		case 12:
+			if cfg.ActiveCommand() == daemonCmd {
+				err = runDaemon(wd, options)
+				break steps
+			}
+			if cfg.ActiveCommand() == watchCmd {
+				err = runWatch(wd, options)
+				break steps
+			}
+		case 13:
+			if cfg.ActiveCommand() == serveCmd {
+				err = runServer(wd, options)
+				break steps
+			}
+		case 14:
+			if stdinArg.Get() && filesFromArg.Get() == "-" {
+				err = usageError{fmt.Errorf("--stdin can't be combined with --files-from=-")}
+				break steps
+			}
+			if stdinArg.Get() {
+				if !formatArg.IsSet() {
+					err = usageError{fmt.Errorf("missing format argument")}
+					break steps
+				}
+				err = unpacker.UnpackReader(os.Stdin, formatArg.Get(), filepath.Join(wd, nameArg.Get()))
+				break steps
+			}
+		case 15:
+			if globArg.IsSet() && matchArg.IsSet() {
+				err = usageError{fmt.Errorf("--glob can't be combined with --match")}
+				break steps
+			}
+			if globArg.IsSet() {
+				errs := map[string]error{}
+				for _, dir := range getDirs(wd) {
+					mergeErrors(errs, unpacker.UnpackFilesGlob(dir, globArg.Get()))
+					if stopBatch(errs) {
+						break
+					}
+				}
+				err = batchError(errs)
+				break steps
+			}
+			if matchArg.IsSet() {
+				errs := map[string]error{}
+				for _, dir := range getDirs(wd) {
+					mergeErrors(errs, unpacker.UnpackFilesMatching(dir, matchArg.Get()))
+					if stopBatch(errs) {
+						break
+					}
+				}
+				err = batchError(errs)
+				break steps
+			}
+		case 16:
+			if dirArg.Get() || dirsArg.IsSet() {
+				errs := map[string]error{}
+				for _, dir := range getDirs(wd) {
+					mergeErrors(errs, unpacker.UnpackAllFiles(dir))
+					if stopBatch(errs) {
+						break
+					}
+				}
+				err = batchError(errs)
+				break steps
+			}
+		case 17:
+			if filesFromArg.IsSet() {
+				err = unpackFilesFrom(unpacker, filesFromArg.Get())
+				break steps
+			}
+			if len(archiveFiles()) == 0 {
+				err = usageError{fmt.Errorf("missing file argument")}
+			}
+		case 18:
+			if files := archiveFiles(); len(files) > 1 {
+				err = unpackFiles(unpacker, files)
+				break steps
+			}
+			err = unpacker.UnpackFile(archiveFiles()[0])
+		}
+	}
+
+	return
+}
+
+// command returns the command name of cfg that takes only the given ones of the globalFlags
+func command(name string, help string, takes ...string) *config.Config {
+	taken := map[string]bool{}
+	for _, f := range takes {
+		taken[f] = true
+	}
+
+	cmd := cfg.MustCommand(name, help)
+	for _, f := range globalFlags {
+		if !taken[f] {
+			cmd = cmd.Skip(f)
+		}
+	}
+	return cmd
+}
+
+// commands are the names of the commands, see takeFiles
+var commands = map[string]bool{
+	"verify":  true,
+	"daemon":  true,
+	"watch":   true,
+	"serve":   true,
+	"history": true,
+	"stats":   true,
+	"catalog": true,
+	"find":    true,
+	"extract": true,
+	"cat":     true,
+	"doctor":  true,
+	"info":    true,
+}
+
+// archiveCommands are the commands that take the archive file as first positional argument, followed by their
+// further arguments, e.g. unpack verify backup.zip, see commandArgs
+var archiveCommands = map[string]bool{
+	"verify":  true,
+	"extract": true,
+	"cat":     true,
+	"info":    true,
+}
+
+// files are the archive files that are given as positional arguments, see takeFiles
+var files []string
+
+// takeFiles removes the archive files that are given as positional arguments, e.g. unpack foo.zip bar.tgz,
+// or by (repeated or comma separated) --file flags from the command line, unless a command is given, and keeps
+// them in their order. Arguments that may be the value of the preceding flag (-v, -m or a long flag with value,
+// but without =) are kept, so the files are given before the flags, after flags without value or like
+// --name=value or after --. The positional arguments of the archiveCommands are taken the same way, but their
+// --file flag is left to the config.
+func takeFiles() {
+	if len(os.Args) < 2 || (commands[os.Args[1]] && !archiveCommands[os.Args[1]]) {
+		return
+	}
+
+	args := []string{os.Args[0]}
+	first := 1
+	if commands[os.Args[1]] {
+		args = append(args, os.Args[1])
+		first = 2
+	}
+	for i := first; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case arg == "--":
+			files = append(files, os.Args[i+1:]...)
+			i = len(os.Args)
+		case first > 1 && (strings.HasPrefix(arg, "-") || takesValue(os.Args[i-1])):
+			args = append(args, arg)
+		case (arg == "-f" || arg == "--file") && i+1 < len(os.Args):
+			i++
+			files = append(files, splitFiles(os.Args[i])...)
+		case strings.HasPrefix(arg, "-f=") || strings.HasPrefix(arg, "--file="):
+			files = append(files, splitFiles(arg[strings.Index(arg, "=")+1:])...)
+		case strings.HasPrefix(arg, "-") || takesValue(os.Args[i-1]):
+			args = append(args, arg)
+		default:
+			files = append(files, arg)
+		}
+	}
+	os.Args = args
+}
+
+// splitFiles returns the comma separated files of a --file flag
+func splitFiles(s string) (files []string) {
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			files = append(files, f)
+		}
+	}
+	return
+}
+
+// boolFlags are the names of the flags without value, see boolFlag
+var boolFlags = map[string]bool{}
+
+// boolFlag returns the name of a flag without value and remembers it for takesValue
+func boolFlag(name string) string {
+	boolFlags[name] = true
+	return name
+}
+
+// takesValue reports whether the argument is a flag that may take the next argument as its value
+func takesValue(arg string) bool {
+	switch arg {
+	case "-f", "-v", "-m":
+		return true
+	}
+	return strings.HasPrefix(arg, "--") && !strings.Contains(arg, "=") && !boolFlags[arg[2:]]
+}
+
+// commandArgs returns the archive file of an archive command (see archiveCommands) and the further positional
+// arguments. The archive is the first positional argument, unless it is given by --file.
+func commandArgs() (archive string, rest []string, err error) {
+	args := files
+	if fileArg.IsSet() {
+		args = append([]string{fileArg.Get()}, files...)
+	}
+	if len(args) == 0 {
+		return "", nil, usageError{fmt.Errorf("missing file argument")}
+	}
+	return args[0], args[1:], nil
+}
+
+// archiveFiles returns the archive files of --file (e.g. of the .unpackrc) followed by the ones of the command
+// line, see takeFiles
+func archiveFiles() []string {
+	if fileArg.IsSet() {
+		return append(splitFiles(fileArg.Get()), files...)
+	}
+	return files
+}
+
+// fileUnpacker unpacks the archive files of the command line, see unpackFiles
+type fileUnpacker interface {
+	UnpackFile(string) error
+}
+
+// unpackFiles unpacks the archive files one after another and returns their errors as batch, like --dir does
+func unpackFiles(unpacker fileUnpacker, files []string) error {
+	errs := map[string]error{}
+	for _, file := range files {
+		if !unpackInto(errs, unpacker, file) {
+			break
+		}
+	}
+	return batchError(errs)
+}
+
+// unpackFilesFrom unpacks the archive files of the command line (see archiveFiles) and then the ones whose paths are
+// read from list (a file or - for stdin) while it is read, so that huge lists (e.g. of find -print0 and --null) don't
+// have to be read first. Empty paths are skipped.
+func unpackFilesFrom(unpacker fileUnpacker, list string) error {
+	var r io.Reader = os.Stdin
+	if list != "-" {
+		f, err := os.Open(list)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	errs := map[string]error{}
+	for _, file := range archiveFiles() {
+		if !unpackInto(errs, unpacker, file) {
+			return batchError(errs)
+		}
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	if nullArg.Get() {
+		sc.Split(scanNull)
+	}
+	for sc.Scan() {
+		file := sc.Text()
+		if !nullArg.Get() {
+			file = strings.TrimSuffix(file, "\r")
+		}
+		if file != "" && !unpackInto(errs, unpacker, file) {
+			return batchError(errs)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		errs[list] = err
+	}
+	return batchError(errs)
+}
+
+// unpackInto unpacks the archive file and adds its error to errs. It returns false, if the batch has to stop
+// (see stopBatch). After the --total-timeout, the file is not unpacked but gets a DeadlineError.
+func unpackInto(errs map[string]error, unpacker fileUnpacker, file string) bool {
+	if deadlinePassed() {
+		errs[sourceName(file)] = &unpack.DeadlineError{Deadline: deadline}
+		return false
+	}
+	if err := unpacker.UnpackFile(file); err != nil {
+		errs[sourceName(file)] = err
+	}
+	return !stopBatch(errs)
+}
+
+// stopBatch reports whether a batch with the errors errs has to stop, because of --fail-fast or --total-timeout
+func stopBatch(errs map[string]error) bool {
+	return (failFastArg.Get() && len(errs) > 0) || deadlinePassed()
+}
+
+// deadlinePassed reports whether the --total-timeout has passed
+func deadlinePassed() bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// scanNull is a bufio.SplitFunc for NUL terminated tokens
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// sourceName returns the absolute path of the archive file or the URL, as it is reported by --json
+func sourceName(file string) string {
+	if abs, err := filepath.Abs(file); err == nil && !strings.Contains(file, "://") {
+		return abs
+	}
+	return file
+}
+
+// rcFile is the name of the project-local file with default flags, see applyRC
+const rcFile = ".unpackrc"
+
+// findRC returns the path of the nearest .unpackrc in wd or one of its parents or "", if there is none
+func findRC(wd string) string {
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		file := filepath.Join(dir, rcFile)
+		if finfo, err := os.Stat(file); err == nil && finfo.Mode().IsRegular() {
+			return file
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// readRC returns the flags of the rc file: one flag per line like on the command line (with or without
+// the leading dashes), empty lines and lines starting with # are skipped
+func readRC(file string) ([]string, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var flags []string
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name := strings.TrimLeft(line, "-")
+		if name == "" || strings.HasPrefix(name, "=") {
+			return nil, fmt.Errorf("%s:%d: invalid flag %#v", file, i+1, line)
+		}
+
+		// allow "name = value"
+		if k, v, found := strings.Cut(name, "="); found {
+			name = strings.TrimSpace(k) + "=" + strings.TrimSpace(v)
+		}
+		flags = append(flags, "--"+name)
+	}
+	return flags, nil
+}
+
+// flagName returns the name of a flag of the command line like --name=value or "" for other arguments
+func flagName(arg string) string {
+	if !strings.HasPrefix(arg, "--") {
+		return ""
+	}
+	name, _, _ := strings.Cut(arg[2:], "=")
+	return name
+}
+
+// applyRC inserts the flags of the nearest .unpackrc (see findRC) before the arguments of the command line,
+// so that project-local defaults override the global configuration. Flags that are given on the command line
+// take precedence. The rc file only applies to the unpacking without command, since the other commands don't
+// know most of the flags.
+func applyRC(wd string) error {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		return nil
+	}
+
+	file := findRC(wd)
+	if file == "" {
+		return nil
+	}
+
+	flags, err := readRC(file)
+	if err != nil {
+		return err
+	}
+
+	given := map[string]bool{}
+	for _, arg := range os.Args[1:] {
+		if name := flagName(arg); name != "" {
+			given[name] = true
+		}
+	}
+
+	args := []string{os.Args[0]}
+	for _, f := range flags {
+		if !given[flagName(f)] {
+			args = append(args, f)
+		}
+	}
+	os.Args = append(args, os.Args[1:]...)
+	return nil
+}
+
+// showProgress prints the progress of the extraction to stderr, overwriting the line
+func showProgress(p unpack.Progress) {
+	if pct := p.Percent(); pct >= 0 {
+		fmt.Fprintf(os.Stderr, "\r%s: %3.0f%% (%d/%d entries)", p.Archive, pct, p.Entries, p.TotalEntries)
+	} else {
+		fmt.Fprintf(os.Stderr, "\r%s: %d entries, %d bytes", p.Archive, p.Entries, p.Bytes)
+	}
+
+	if p.TotalEntries > 0 && p.Entries >= p.TotalEntries {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func getRmDirs() (rmdirs []string) {
+	if rmMACOSXArg.Get() {
+		rmdirs = append(rmdirs, "__MACOSX")
+	}
+	if rmGitArg.Get() {
+		rmdirs = append(rmdirs, ".git")
+	}
+	if rmSvnArg.Get() {
+		rmdirs = append(rmdirs, ".svn")
+	}
+	return
+}
+
+func openHistory() (*unpack.History, error) {
+	file := historyArg.Get()
+	if !historyArg.IsSet() {
+		var err error
+		file, err = unpack.DefaultHistoryFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rotation, err := getRotation()
+	if err != nil {
+		return nil, err
+	}
+
+	h, err := unpack.OpenHistory(file)
+	if err != nil {
+		return nil, err
+	}
+	h.Rotation = rotation
+	return h, nil
+}
+
+// getRotation returns the rotation of the log files given by the flags
+func getRotation() (r unpack.Rotation, err error) {
+	if rotateSizeArg.IsSet() {
+		r.MaxSize, err = parseSize(rotateSizeArg.Get())
+		if err != nil {
+			return r, usageError{err}
+		}
+	}
+	if rotateAgeArg.IsSet() {
+		r.MaxAge, err = time.ParseDuration(rotateAgeArg.Get())
+		if err != nil {
+			return r, usageError{fmt.Errorf("invalid value for rotate-age: %#v", rotateAgeArg.Get())}
+		}
+	}
+	r.MaxBackups = int(rotateKeepArg.Get())
+	return r, nil
+}
+
+// showHistory prints the entries of the history that match the filter flags
+func showHistory() error {
+	var q unpack.HistoryQuery
+
+	switch statusArg.Get() {
+	case "", unpack.StatusOK, unpack.StatusFailed:
+		q.Status = statusArg.Get()
+	default:
+		return usageError{fmt.Errorf("invalid value for status: %#v", statusArg.Get())}
+	}
+
+	if sinceArg.IsSet() {
+		since, err := time.ParseInLocation("2006-01-02", sinceArg.Get(), time.Local)
+		if err != nil {
+			since, err = time.Parse(time.RFC3339, sinceArg.Get())
+		}
+		if err != nil {
+			return usageError{fmt.Errorf("invalid value for since: %#v", sinceArg.Get())}
+		}
+		q.Since = since
+	}
+
+	q.Archive = archiveArg.Get()
+
+	h, err := openHistory()
+	if err != nil {
+		return err
+	}
+
+	entries, err := h.Query(q)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		fmt.Printf("%s %-6s %s -> %s (%s)\n", e.Time.Format(time.RFC3339), e.Status, e.Archive, e.Dir, e.Duration.Round(time.Millisecond))
+		if e.Error != "" {
+			fmt.Printf("  %s\n", e.Error)
+		}
+	}
+	return nil
+}
+
+func openStats() (*unpack.StatsFile, error) {
+	file := statsFileArg.Get()
+	if !statsFileArg.IsSet() {
+		var err error
+		file, err = unpack.DefaultStatsFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return unpack.OpenStats(file)
+}
+
+// showStats prints the recorded statistics by format, the most frequent first
+func showStats() error {
+	s, err := openStats()
+	if err != nil {
+		return err
+	}
+
+	st, err := s.Read()
+	if err != nil {
+		return err
+	}
+
+	if len(st.Formats) == 0 {
+		fmt.Println("no statistics recorded yet, pass --stats to record them")
+		return nil
+	}
+
+	var formats []string
+	for f := range st.Formats {
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(a, b int) bool {
+		fa, fb := st.Formats[formats[a]], st.Formats[formats[b]]
+		if fa.Archives != fb.Archives {
+			return fa.Archives > fb.Archives
+		}
+		return formats[a] < formats[b]
+	})
+
+	fmt.Printf("since %s\n\n", st.Since.Format(time.RFC3339))
+	fmt.Printf("%-10s %9s %9s %10s %15s %12s\n", "format", "archives", "failed", "files", "bytes", "duration")
+	line := func(name string, f unpack.FormatStats) {
+		fmt.Printf("%-10s %9d %8.1f%% %10d %15d %12s\n", name, f.Archives, f.FailureRate()*100, f.Files, f.Bytes, f.Duration.Round(time.Millisecond))
+	}
+	for _, f := range formats {
+		line(f, *st.Formats[f])
+	}
+	line("total", st.Total())
+	return nil
+}
+
+// missingToolsError is the error of unpack doctor, if tools are missing or can't be run
+type missingToolsError []string
+
+func (m missingToolsError) Error() string {
+	return "missing or broken tools: " + strings.Join(m, ", ")
+}
+
+// runDoctor shows the tools of the registered unpackers and testers with their versions or how to install them
+func runDoctor() error {
+	var missing missingToolsError
+	for _, t := range unpack.DiagnoseTools() {
+		status, info := "ok", t.Version
+		if t.Err != nil {
+			// the unpackers don't depend on their fallbacks
+			if !t.Fallback {
+				missing = append(missing, t.Name)
+			}
+			status, info = "missing", t.Hint()
+			if t.Path != "" {
+				status, info = "broken", t.Err.Error()+", "+t.Hint()
+			}
+			if t.Fallback {
+				info += " (optional fallback)"
+			} else if t.Native {
+				info += " (or pass --native)"
+			}
+		}
+		if !quietArg.Get() {
+			fmt.Printf("%-10s %-7s %s [%s]\n", t.Name, status, info, strings.Join(t.Extensions, " "))
+		}
+	}
+
+	if !quietArg.Get() {
+		decompressors := unpack.Decompressors()
+		formats := make([]string, 0, len(decompressors))
+		for format := range decompressors {
+			formats = append(formats, format)
+		}
+		sort.Strings(formats)
+		fmt.Println("\nparallel decompressors:")
+		for _, format := range formats {
+			cmd := decompressors[format]
+			if cmd == "" {
+				cmd = "none (optional)"
+			}
+			fmt.Printf("%-10s %s\n", format, cmd)
+		}
+	}
+
+	if len(missing) > 0 {
+		return missing
+	}
+	if !quietArg.Get() {
+		fmt.Println("\nall tools are available")
+	}
+	return nil
+}
+
+// listFormats shows the registered unpackers for --list-formats
+func listFormats() {
+	for _, f := range unpack.Formats() {
+		status := "ok"
+		if !f.Available() {
+			status = "missing " + strings.Join(f.Missing, ", ")
+			if f.Native {
+				status += " (native)"
+			}
+		}
+		if len(f.Aliases) > 0 {
+			status += " [also " + strings.Join(f.Aliases, " ") + "]"
+		}
+		fmt.Printf("%-10s %-40s %s\n", f.Ext, f.Command, status)
+	}
+}
+
+func openCatalog() (*unpack.Catalog, error) {
+	file := catalogArg.Get()
+	if !catalogArg.IsSet() {
+		var err error
+		file, err = unpack.DefaultCatalogFile()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return unpack.OpenCatalog(file)
+}
+
+// runCatalog adds the archive file or the archives inside the directories to the catalog
+func runCatalog(wd string) error {
+	c, err := openCatalog()
+	if err != nil {
+		return err
+	}
+
+	if fileArg.IsSet() {
+		file := fileArg.Get()
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(wd, file)
+		}
+		return batchError(c.Add(file))
+	}
+
+	errs := map[string]error{}
+	for _, dir := range getDirs(wd) {
+		mergeErrors(errs, c.AddDir(dir))
+	}
+	return batchError(errs)
+}
+
+// catEntry writes the content of the entry of the archive file to stdout, e.g. unpack cat backup.tgz etc/config.yml
+func catEntry() error {
+	archive, rest, err := commandArgs()
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return usageError{fmt.Errorf("expected the path of a single entry after the archive file")}
+	}
+
+	rc, err := unpack.OpenEntry(archive, rest[0])
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = io.Copy(os.Stdout, rc)
+	return err
+}
+
+// showInfo prints what unpacking the archive file would produce
+func showInfo() error {
+	archive, rest, err := commandArgs()
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return usageError{fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))}
+	}
+
+	info, err := unpack.Inspect(archive)
+	if err != nil {
+		return err
+	}
+
+	kind := info.Class.String()
+	if info.CompressedTar {
+		kind += ", compressed tar"
+	}
+	fmt.Printf("format:       %s (%s)\n", info.Format, kind)
+	fmt.Printf("size:         %d bytes\n", info.Size)
+
+	if !info.Listed {
+		fmt.Printf("entries:      unknown\n")
+	} else {
+		fmt.Printf("entries:      %d\n", info.Entries)
+	}
+
+	if info.UncompressedSize < 0 {
+		fmt.Printf("uncompressed: unknown\n")
+	} else {
+		fmt.Printf("uncompressed: %d bytes\n", info.UncompressedSize)
+		fmt.Printf("ratio:        %.2f\n", info.Ratio())
+	}
+
+	if info.SingleFile {
+		fmt.Printf("dir:          - (single file)\n")
+	} else {
+		fmt.Printf("dir:          %s\n", info.Dir)
+	}
+
+	if info.Listed {
+		fmt.Printf("top level:    %s\n", strings.Join(info.TopLevel, ", "))
+		fmt.Printf("flattened:    %v\n", info.Flattened)
+	}
+	return nil
+}
+
+// findInCatalog prints the entries of the catalog that match the pattern or extracts them
+func findInCatalog(wd string, options []unpack.Option) error {
+	c, err := openCatalog()
+	if err != nil {
+		return err
+	}
+
+	entries, err := c.Find(patternArg.Get())
+	if err == path.ErrBadPattern {
+		return usageError{fmt.Errorf("invalid pattern: %#v", patternArg.Get())}
+	}
+	if err != nil {
+		return err
+	}
+
+	if extractArg.Get() {
+		dest := wd
+		if destArg.IsSet() {
+			dest = destArg.Get()
+			if !filepath.IsAbs(dest) {
+				dest = filepath.Join(wd, dest)
+			}
+		}
+		return batchError(unpack.New(options...).ExtractFound(entries, dest))
+	}
+
+	for _, e := range entries {
+		if e.Dir || e.Size < 0 {
+			fmt.Printf("%s: %s\n", e.Archive, e.Name)
+			continue
+		}
+		fmt.Printf("%s: %s (%d bytes)\n", e.Archive, e.Name, e.Size)
+	}
+	return nil
+}
+
+// metrics are exposed at /metrics of the daemon and the server, see --metrics
+var metrics = unpack.NewMetrics()
+
+// runDaemon scans the directories as scheduled until the process is interrupted
+func runDaemon(wd string, options []unpack.Option) error {
+	d, err := unpack.NewDaemon(scheduleArg.Get(), getDirs(wd), options...)
+	if err != nil {
+		return usageError{err}
+	}
+
+	d.Pattern = matchArg.Get()
+	d.Jitter = time.Duration(jitterArg.Get()) * time.Second
+	d.Queue, err = openQueue(options)
+	if err != nil {
+		return err
+	}
+	if d.Queue != nil {
+		defer d.Queue.Close()
+	}
+	d.Report = func(errs map[string]error) {
+		if !quietArg.Get() {
+			reportError(unpack.NewBatchError(errs, 0))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveMetrics(ctx, stop)
+	return d.Run(ctx)
+}
+
+// runWatch unpacks the archives that appear inside the watched directories until the process is interrupted
+func runWatch(wd string, options []unpack.Option) error {
+	dirs := getDirs(wd)
+	if watchDirArg.IsSet() {
+		dir := watchDirArg.Get()
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(wd, dir)
+		}
+		dirs = []string{dir}
+	}
+
+	w := unpack.NewWatcher(dirs, options...)
+	w.Pattern = matchArg.Get()
+
+	var err error
+	w.Queue, err = openQueue(options)
+	if err != nil {
+		return err
+	}
+	if w.Queue != nil {
+		defer w.Queue.Close()
+	}
+	w.Report = func(errs map[string]error) {
+		if !quietArg.Get() {
+			reportError(unpack.NewBatchError(errs, 0))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serveMetrics(ctx, stop)
+	return w.Run(ctx)
+}
+
+// openQueue returns the Queue for --queue-file and --retries or nil, if none of them is set
+func openQueue(options []unpack.Option) (*unpack.Queue, error) {
+	if !queueFileArg.IsSet() && retriesArg.Get() == 0 {
+		return nil, nil
+	}
+
+	q := unpack.NewQueue(options...)
+	q.Retries = int(retriesArg.Get())
+	q.Backoff = time.Duration(backoffArg.Get()) * time.Second
+
+	if queueFileArg.IsSet() {
+		err := q.Persist(queueFileArg.Get())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// serveMetrics serves /metrics at --listen until ctx is done, if --metrics is set. If the server fails, stop is called.
+func serveMetrics(ctx context.Context, stop func()) {
+	if !metricsArg.Get() {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+	srv := &http.Server{Addr: listenArg.Get(), Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	go func() {
+		if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+			fmt.Fprintln(os.Stderr, err.Error())
+			stop()
+		}
+	}()
+}
+
+// runServer serves the trigger and the upload handler until the process is interrupted
+func runServer(wd string, options []unpack.Option) error {
+	roots := getDirs(wd)
+
+	mux := http.NewServeMux()
+	trigger := unpackhttp.NewTrigger(roots, options...)
+	if policyArg.IsSet() {
+		p, err := unpackhttp.LoadPolicy(policyArg.Get())
+		if err != nil {
+			return usageError{err}
+		}
+		trigger.Policy = p
+	}
+
+	upload := unpackhttp.New(roots[0], options...)
+	jobs := unpackhttp.NewJobs(trigger, upload, runtime.GOMAXPROCS(0))
+
+	mux.Handle("/unpack", trigger)
+	mux.Handle("/upload", upload)
+	mux.Handle("/jobs", jobs)
+	mux.Handle("/jobs/", jobs)
+	if metricsArg.Get() {
+		mux.Handle("/metrics", metrics)
+	}
+
+	srv := &http.Server{Addr: listenArg.Get(), Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if grpcArg.IsSet() {
+		l, err := net.Listen("tcp", grpcArg.Get())
+		if err != nil {
+			return err
+		}
+		gs := grpc.NewServer()
+		unpackgrpc.Register(gs, unpackgrpc.NewServer(trigger))
+		go gs.Serve(l)
+		defer gs.GracefulStop()
+	}
+
+	go func() {
+		<-ctx.Done()
+		srv.Shutdown(context.Background())
+	}()
+
+	err := srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// getDirs returns the directories given by --dirs and the working directory, if --dir is set or
+// no directories are given
+func getDirs(wd string) (dirs []string) {
+	if dirsArg.IsSet() {
+		for _, dir := range strings.Split(dirsArg.Get(), ",") {
+			dir = strings.TrimSpace(dir)
+			if dir == "" {
+				continue
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(wd, dir)
+			}
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if dirArg.Get() || len(dirs) == 0 {
+		dirs = append(dirs, wd)
+	}
+	return
+}
+
+// mergeErrors adds the errors of a directory to the errors of all directories
+func mergeErrors(all map[string]error, errs map[string]error) {
+	for k, v := range errs {
+		all[k] = v
+	}
+}
+
+// stringFlag is a flag with a string value, e.g. maxSizeArg
+type stringFlag interface {
+	Get() string
+	IsSet() bool
+}
+
+// limitOptions returns the options of the flags --maxsize, --tool-concurrency and --decompressors. The first
+// invalid value is returned as usageError, without any options, so that a typo never lifts a limit.
+func limitOptions(maxSize, toolConcurrency, decompressors stringFlag) (options []unpack.Option, err error) {
+	if maxSize.IsSet() {
+		size, err := parseSize(maxSize.Get())
+		if err != nil {
+			return nil, usageError{err}
+		}
+		options = append(options, unpack.MaxExtractedSize(size))
+	}
+	if toolConcurrency.IsSet() {
+		limits, err := parseLimits(toolConcurrency.Get())
+		if err != nil {
+			return nil, usageError{err}
+		}
+		options = append(options, unpack.ToolConcurrency(limits))
+	}
+	if decompressors.IsSet() {
+		cmds, err := parseDecompressors(decompressors.Get())
+		if err != nil {
+			return nil, usageError{err}
+		}
+		for format, cmd := range cmds {
+			options = append(options, unpack.Decompressor(format, cmd))
+		}
+	}
+	return options, nil
+}
+
+// parseSize parses sizes like 1024, 500K, 20M or 2G
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	factor := int64(1)
+
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, unit) {
+			factor = 1 << (10 * uint(i+1))
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %#v", s)
+	}
+	return n * factor, nil
+}
+
+// parseLimits parses comma separated limits by name like 7z=1,unzip=4
+func parseLimits(s string) (map[string]int, error) {
+	limits := map[string]int{}
+
+	for _, l := range strings.Split(s, ",") {
+		idx := strings.Index(l, "=")
+		if idx < 1 {
+			return nil, fmt.Errorf("invalid limit: %#v", l)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(l[idx+1:]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid limit: %#v", l)
+		}
+		limits[strings.TrimSpace(l[:idx])] = n
+	}
+	return limits, nil
+}
+
+// parseDecompressors parses the decompressors of --decompressors, e.g. "xz=xz -T0,gzip=gzip"
+func parseDecompressors(s string) (map[string]string, error) {
+	known := unpack.Decompressors()
+	decompressors := map[string]string{}
+
+	for _, d := range strings.Split(s, ",") {
+		idx := strings.Index(d, "=")
+		if idx < 1 || strings.TrimSpace(d[idx+1:]) == "" {
+			return nil, fmt.Errorf("invalid decompressor: %#v", d)
+		}
+		format := strings.TrimSpace(d[:idx])
+		if _, has := known[format]; !has {
+			return nil, fmt.Errorf("unknown decompressor format: %#v", format)
+		}
+		decompressors[format] = strings.TrimSpace(d[idx+1:])
+	}
+	return decompressors, nil
+}
+
+// result is the result of an archive for --json
+type result struct {
+	Source   string  `json:"source"`
+	Dir      string  `json:"dir,omitempty"`
+	Files    int64   `json:"files"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+	Code     string  `json:"code,omitempty"`
+	Hint     string  `json:"hint,omitempty"`
+}
+
+// results are the results of the unpacked archives, see addResult
+var results []result
+
+func addResult(j unpack.Job) {
+	r := result{Source: j.Archive, Dir: j.Dir, Files: j.Files, Bytes: j.Bytes, Duration: j.Duration.Seconds()}
+	if j.Err != nil {
+		r.Error, r.Code, r.Hint = j.Err.Error(), unpack.ErrorCode(j.Err), unpack.Hint(j.Err)
+	}
+	results = append(results, r)
+}
+
+// printDir prints the directory that has been created for an archive for --print-dir and --print0
+func printDir(j unpack.Job) {
+	if j.Err != nil || j.Dir == "" {
+		return
+	}
+	if print0Arg.Get() {
+		fmt.Fprint(os.Stdout, j.Dir+"\x00")
+		return
+	}
+	fmt.Fprintln(os.Stdout, j.Dir)
+}
+
+// printResults prints the results as JSON to stdout, together with the errors of the archives that failed before
+// they were unpacked (e.g. because of a bad checksum)
+func printResults(err error) {
+	reported := map[string]bool{}
+	for _, r := range results {
+		if r.Error != "" {
+			reported[r.Source] = true
+		}
+	}
+
+	failed := func(source string, err error) {
+		results = append(results, result{Source: source, Error: err.Error(), Code: unpack.ErrorCode(err), Hint: unpack.Hint(err)})
+	}
+
+	switch e := err.(type) {
+	case nil:
+	case *unpack.BatchError:
+		for _, ae := range e.Errors {
+			if !reported[ae.Archive] {
+				failed(ae.Archive, ae.Err)
+			}
+		}
+	default:
+		if len(reported) == 0 {
+			source := "-"
+			if files := archiveFiles(); !stdinArg.Get() && len(files) > 0 {
+				source = sourceName(files[0])
+			}
+			failed(source, err)
+		}
+	}
+
+	if results == nil {
+		results = []result{}
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(results)
+}
+
+func reportError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR!")
+		if b, ok := err.(*unpack.BatchError); ok {
+			for _, ae := range b.Errors {
+				fmt.Fprintf(os.Stderr, "## %s ##\n%s\n", ae.Archive, ae.Err.Error())
+				printHint(ae.Err)
+				fmt.Fprintln(os.Stderr)
+			}
+			fmt.Fprintln(os.Stderr, b.Footer())
+			return
+		}
+
+		fmt.Fprintln(os.Stderr, err.Error())
+		printHint(err)
+	}
+}
+
+// printHint prints the hint how to fix err (see unpack.Hint) to stderr, if there is one
+func printHint(err error) {
+	if hint := unpack.Hint(err); hint != "" {
+		fmt.Fprintln(os.Stderr, "hint:", hint)
+	}
+}
+
+// batchError returns the errors of a batch as *unpack.BatchError with the number of the archives that have been
+// unpacked or have failed, or nil, if there are no errors
+func batchError(errs map[string]error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return unpack.NewBatchError(errs, int(atomic.LoadInt64(&archivesDone)))
 }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// flag is a stringFlag with a fixed value, the zero flag is not set
+type flag struct {
+	value string
+	set   bool
+}
+
+func (f flag) Get() string { return f.value }
+func (f flag) IsSet() bool { return f.set }
+
+func set(value string) flag { return flag{value: value, set: true} }
+
+func TestLimitOptions(t *testing.T) {
+	tests := []struct {
+		name                                    string
+		maxSize, toolConcurrency, decompressors flag
+		options                                 int
+		invalid                                 bool
+	}{
+		{name: "none"},
+		{name: "valid", maxSize: set("20M"), toolConcurrency: set("7z=1"), decompressors: set("gzip=gzip"), options: 3},
+		{name: "invalid size", maxSize: set("20X"), invalid: true},
+		{name: "invalid size before valid tool concurrency", maxSize: set("20X"), toolConcurrency: set("7z=1"), invalid: true},
+		{name: "invalid size before valid decompressors", maxSize: set("-1"), decompressors: set("gzip=gzip"), invalid: true},
+		{name: "invalid tool concurrency", maxSize: set("1G"), toolConcurrency: set("7z"), invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := limitOptions(tt.maxSize, tt.toolConcurrency, tt.decompressors)
+
+			if _, isUsage := err.(usageError); isUsage != tt.invalid {
+				t.Fatalf("expected a usage error: %v, got %v", tt.invalid, err)
+			}
+			if len(options) != tt.options {
+				t.Errorf("expected %d options, got %d", tt.options, len(options))
+			}
+		})
+	}
+}
+
+// TestGlobalFlags checks that globalFlags has all flags of cfg and that the commands only take global flags
+func TestGlobalFlags(t *testing.T) {
+	f, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	global := map[string]bool{}
+	for _, name := range globalFlags {
+		if global[name] {
+			t.Errorf("flag %s is given twice", name)
+		}
+		global[name] = true
+	}
+
+	// str returns the value of the string literal e or of boolFlag(literal)
+	str := func(e ast.Expr) string {
+		if call, ok := e.(*ast.CallExpr); ok && len(call.Args) == 1 {
+			e = call.Args[0]
+		}
+		lit, ok := e.(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return ""
+		}
+		s, _ := strconv.Unquote(lit.Value)
+		return s
+	}
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+
+		switch fn := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			if x, ok := fn.X.(*ast.Ident); ok && x.Name == "cfg" && fn.Sel.Name != "MustCommand" {
+				if name := str(call.Args[0]); name != "" && !global[name] {
+					t.Errorf("flag %s is missing in globalFlags", name)
+				}
+			}
+		case *ast.Ident:
+			if fn.Name == "command" && len(call.Args) > 2 {
+				for _, arg := range call.Args[2:] {
+					if name := str(arg); !global[name] {
+						t.Errorf("command %s takes the unknown flag %s", str(call.Args[0]), name)
+					}
+				}
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,126 @@
+package unpack
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrorPolicy decides what UnpackAllFiles and UnpackFilesMatching do after an archive has failed.
+type ErrorPolicy int
+
+const (
+	// ContinueOnError unpacks the remaining archives. This is the default.
+	ContinueOnError ErrorPolicy = iota
+
+	// FailFast does not unpack the remaining archives, e.g. because a missing tool would let them fail, too.
+	FailFast
+)
+
+func (e ErrorPolicy) String() string {
+	switch e {
+	case ContinueOnError:
+		return "continue"
+	case FailFast:
+		return "fail-fast"
+	default:
+		return fmt.Sprintf("ErrorPolicy(%d)", int(e))
+	}
+}
+
+// BatchErrorPolicy returns an Option that sets what UnpackAllFiles and UnpackFilesMatching do after an archive has
+// failed. With FailFast they return the error of the first failed archive and leave the remaining ones untouched.
+// It is meant to be passed to New().
+func BatchErrorPolicy(policy ErrorPolicy) Option {
+	return func(c *config) {
+		c.errorPolicy = policy
+	}
+}
+
+// ArchiveError is the error of an archive inside a BatchError.
+type ArchiveError struct {
+	Archive string
+	Err     error
+}
+
+// Error returns the summary line of the archive, e.g. `/data/b.tgz: exit status 2 [command_failed]`.
+func (a *ArchiveError) Error() string {
+	msg := strings.TrimSpace(a.Err.Error())
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		msg = msg[:i] + " ..."
+	}
+	return fmt.Sprintf("%s: %s [%s]", a.Archive, msg, ErrorCode(a.Err))
+}
+
+// Unwrap returns the error of the archive.
+func (a *ArchiveError) Unwrap() error {
+	return a.Err
+}
+
+// BatchError is the error of a batch of archives, e.g. of the maps that UnpackAllFiles and UnpackFilesMatching
+// return. Other than the maps, its errors are ordered by the paths of the archives, so that reports don't differ
+// between runs. errors.Is and errors.As look into all of the errors.
+type BatchError struct {
+	// Errors are the errors of the failed archives, ordered by their paths
+	Errors []*ArchiveError
+
+	// Total is the number of the archives of the batch, it is 0 if it is unknown
+	Total int
+}
+
+// NewBatchError returns the BatchError of the errors by archive of a batch with total archives (0 = unknown) or
+// nil, if there are no errors.
+func NewBatchError(errs map[string]error, total int) *BatchError {
+	if len(errs) == 0 {
+		return nil
+	}
+
+	b := &BatchError{Total: total}
+	for archive, err := range errs {
+		b.Errors = append(b.Errors, &ArchiveError{Archive: archive, Err: err})
+	}
+	sort.Slice(b.Errors, func(i, j int) bool {
+		return b.Errors[i].Archive < b.Errors[j].Archive
+	})
+	return b
+}
+
+// Error returns a summary line per failed archive and the footer, see Footer.
+func (b *BatchError) Error() string {
+	var bf strings.Builder
+	for _, e := range b.Errors {
+		bf.WriteString(e.Error())
+		bf.WriteByte('\n')
+	}
+	bf.WriteString(b.Footer())
+	return bf.String()
+}
+
+// Footer returns how many archives have failed, e.g. "2 of 12 archives failed".
+func (b *BatchError) Footer() string {
+	if b.Total < len(b.Errors) {
+		return fmt.Sprintf("%d %s failed", len(b.Errors), plural(len(b.Errors), "archive"))
+	}
+	return fmt.Sprintf("%d of %d %s failed", len(b.Errors), b.Total, plural(b.Total, "archive"))
+}
+
+// Partial reports whether some archives of the batch have been unpacked while others have failed.
+func (b *BatchError) Partial() bool {
+	return b.Total > len(b.Errors)
+}
+
+// Unwrap returns the errors of the archives (as *ArchiveError).
+func (b *BatchError) Unwrap() []error {
+	errs := make([]error, len(b.Errors))
+	for i, e := range b.Errors {
+		errs[i] = e
+	}
+	return errs
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
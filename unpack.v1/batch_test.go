@@ -0,0 +1,125 @@
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+// writeTar writes a tar archive with the given files (name and content) to file
+func writeTar(t *testing.T, file string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	for name, content := range files {
+		err = tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		if err == nil {
+			_, err = tw.Write([]byte(content))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeZip writes a zip archive with the given files (name and content) to file
+func writeZip(t *testing.T, file string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err == nil {
+			_, err = w.Write([]byte(content))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tree returns the paths of everything inside dir, relative to dir
+func tree(t *testing.T, dir string) []string {
+	t.Helper()
+	var paths []string
+	err := filepath.Walk(dir, func(p string, _ os.FileInfo, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		paths = append(paths, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestBatchSkipsOwnOutput(t *testing.T) {
+	parent := t.TempDir()
+	t.Chdir(parent)
+
+	// a relative directory, while the created directories are known by their absolute paths
+	dir := "archives"
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTar(t, filepath.Join(dir, "a.tar"), map[string]string{"a.txt": "a"})
+	writeZip(t, filepath.Join(dir, "b.zip"), map[string]string{"b.txt": "b"})
+
+	u := New(Native)
+	if errs := u.UnpackAllFiles(dir); errs != nil {
+		t.Fatalf("first run: %v", errs)
+	}
+	want := tree(t, dir)
+
+	if errs := u.UnpackAllFiles(dir); errs != nil {
+		t.Fatalf("second run: %v", errs)
+	}
+
+	// the moved archives inside the created directories are not unpacked again, however the directory is given
+	for _, d := range []string{dir, filepath.Join(parent, dir), "./" + dir + "/../" + dir} {
+		for _, pattern := range []string{"*/*.tar", "*/*.zip"} {
+			if errs := u.UnpackFilesGlob(d, pattern); errs != nil {
+				t.Fatalf("glob %s inside %s: %v", pattern, d, errs)
+			}
+		}
+	}
+
+	got := tree(t, dir)
+	if len(got) != len(want) {
+		t.Fatalf("the created directories have been processed again:\n got %v\nwant %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("the created directories have been processed again:\n got %v\nwant %v", got, want)
+		}
+	}
+
+	for _, p := range []string{"a/a.tar", "a/a.txt", "b/b.zip", "b/b.txt"} {
+		if _, err := os.Stat(filepath.Join(dir, p)); err != nil {
+			t.Errorf("missing %s: %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package unpack
+
+import (
+	"bufio"
+	"encoding/json"
+	"lib"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CatalogEntry is an entry of an archive inside the Catalog.
+type CatalogEntry struct {
+	Archive string    `json:"archive"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Dir     bool      `json:"dir,omitempty"`
+
+	// Hash is a checksum that the archive stores anyway, like "crc32:0a1b2c3d" for zips
+	Hash string `json:"hash,omitempty"`
+}
+
+// Catalog is a persistent index of the entries of archives, so that one can find out which archive contains
+// a file without extracting anything. Like the History, the entries are stored as JSON lines inside a file.
+// Archives are listed natively, see CanCatalog.
+type Catalog struct {
+	file string
+	mx   sync.Mutex
+}
+
+// OpenCatalog returns the Catalog that is stored inside file. The file and its directory are created,
+// if they don't exist.
+func OpenCatalog(file string) (*Catalog, error) {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{file: file}, f.Close()
+}
+
+// DefaultCatalogFile returns the default location of the Catalog inside the configuration directory of the user.
+func DefaultCatalogFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "unpack", "catalog.jsonl"), nil
+}
+
+// CanCatalog reports whether the entries of the archive file can be added to a Catalog, i.e. whether it is
+// a .tar, .tgz, .tar.gz, .tbz2, .tbz, .tar.bz2, .zip, .gz or .bz2 file.
+func CanCatalog(file string) bool {
+	return lib.CanList(lib.Ext(filepath.Base(file)))
+}
+
+// Add lists the entries of the archive files and adds them to the Catalog. Entries of archives that
+// have been added before are replaced. The archives that could not be listed are returned with their errors.
+func (c *Catalog) Add(files ...string) (errors map[string]error) {
+	errs := map[string]error{}
+	archives := map[string]bool{}
+	var added []CatalogEntry
+
+	for _, file := range files {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			errs[file] = err
+			continue
+		}
+
+		entries, err := lib.List(abs)
+		if err != nil {
+			errs[file] = err
+			continue
+		}
+
+		archives[abs] = true
+		for _, e := range entries {
+			added = append(added, CatalogEntry{Archive: abs, Name: e.Name, Size: e.Size, ModTime: e.ModTime, Dir: e.Dir, Hash: e.Hash})
+		}
+	}
+
+	if len(archives) > 0 {
+		if err := c.replace(archives, added); err != nil {
+			errs[c.file] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// AddDir adds all archives inside dir that can be listed (see CanCatalog) to the Catalog, like Add.
+func (c *Catalog) AddDir(dir string) (errors map[string]error) {
+	files, err := archivesInDir(dir, CanCatalog)
+	if err != nil {
+		return map[string]error{dir: err}
+	}
+	return c.Add(files...)
+}
+
+// replace rewrites the catalog file without the entries of the given archives, followed by the added entries
+func (c *Catalog) replace(archives map[string]bool, added []CatalogEntry) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	var keep []CatalogEntry
+	err := c.each(func(e *CatalogEntry) {
+		if !archives[e.Archive] {
+			keep = append(keep, *e)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	tmp := c.file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range append(keep, added...) {
+		err = enc.Encode(e)
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, c.file)
+}
+
+// each calls fn for every entry of the catalog file, c.mx must be held
+func (c *Catalog) each(fn func(*CatalogEntry)) error {
+	f, err := os.Open(c.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		var e CatalogEntry
+		// skip broken lines, e.g. of a process that was killed while writing
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		fn(&e)
+	}
+	return sc.Err()
+}
+
+// Find returns the entries of the Catalog whose name or base name matches the pattern (see path.Match),
+// e.g. "*.go" or "docs/*.md", in the order of the Catalog.
+func (c *Catalog) Find(pattern string) ([]CatalogEntry, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	var found []CatalogEntry
+	err := c.each(func(e *CatalogEntry) {
+		name := path.Clean(e.Name)
+		if m, _ := path.Match(pattern, name); m {
+			found = append(found, *e)
+			return
+		}
+		if m, _ := path.Match(pattern, path.Base(name)); m {
+			found = append(found, *e)
+		}
+	})
+	return found, err
+}
+
+// ExtractFound extracts just the given entries (as returned by Catalog.Find) of their archives with the native backend.
+// Each archive gets a subdirectory of dir that is named after it (- its extension), inside of which the entries keep
+// their paths. The archives stay where they are. Archives that could not be extracted are returned with their errors.
+func (c *config) ExtractFound(entries []CatalogEntry, dir string) (errors map[string]error) {
+	var archives []string
+	names := map[string][]string{}
+
+	for _, e := range entries {
+		if _, has := names[e.Archive]; !has {
+			archives = append(archives, e.Archive)
+		}
+		names[e.Archive] = append(names[e.Archive], e.Name)
+	}
+
+	errs := map[string]error{}
+	for _, archive := range archives {
+		base := filepath.Base(archive)
+		sub := filepath.Join(dir, strings.TrimSuffix(base, lib.Ext(base)))
+
+		if err := lib.ExtractEntries(archive, names[archive], sub, &c.Options); err != nil {
+			errs[archive] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package unpack
+
+import (
+	"context"
+	"lib"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// Schedule is a cron-like schedule, e.g. "*/10 * * * *" or "@every 5m".
+type Schedule = lib.Schedule
+
+// ParseSchedule parses a cron-like schedule with the five fields minute, hour, day of month, month and
+// day of week. Each field may be *, a number, a range (1-5), a step (*/10, 1-30/5) or a comma separated
+// list of them. Alternatively "@every <duration>" runs in a fixed interval, e.g. "@every 90s".
+func ParseSchedule(spec string) (*Schedule, error) {
+	return lib.ParseSchedule(spec)
+}
+
+// Daemon unpacks the archives inside of directories again and again, e.g. inside download folders.
+// Since network mounts often don't deliver filesystem events, the directories are scanned
+// periodically as given by the schedule.
+type Daemon struct {
+	// Dirs are the directories that are scanned
+	Dirs []string
+
+	// Pattern is a regular expression, if it is not empty, only the matching files are unpacked
+	Pattern string
+
+	// Schedule decides when the directories are scanned
+	Schedule *Schedule
+
+	// Jitter is the maximal random delay of a scheduled scan, so that several daemons
+	// don't hit a shared mount at the same time
+	Jitter time.Duration
+
+	// Report is called with the errors of each scan, if there are any
+	Report func(errs map[string]error)
+
+	// Queue is optional. If it is set, the archives are unpacked as Bulk jobs of the queue (with the
+	// options of the queue), so that the Interactive jobs of the same queue jump ahead of them.
+	Queue *Queue
+
+	unpacker *config
+	scanning int32
+}
+
+// NewDaemon returns a Daemon that scans dirs as given by the cron-like schedule and unpacks the archives
+// inside of them with the given options (see New).
+func NewDaemon(schedule string, dirs []string, opts ...Option) (*Daemon, error) {
+	s, err := ParseSchedule(schedule)
+	if err != nil {
+		return nil, err
+	}
+	return &Daemon{Dirs: dirs, Schedule: s, unpacker: New(opts...).(*config)}, nil
+}
+
+// Scan unpacks the archives inside of all directories once and returns the merged errors.
+// If a scan is already running, Scan returns immediately without doing anything, so that
+// slow scans don't overlap.
+func (d *Daemon) Scan() map[string]error {
+	if !atomic.CompareAndSwapInt32(&d.scanning, 0, 1) {
+		return nil
+	}
+	defer atomic.StoreInt32(&d.scanning, 0)
+
+	errs := map[string]error{}
+	for _, dir := range d.Dirs {
+		var dirErrs map[string]error
+		switch {
+		case d.Queue != nil:
+			dirErrs = d.queueDir(dir)
+		case d.Pattern != "":
+			dirErrs = d.unpacker.UnpackFilesMatching(dir, d.Pattern)
+		default:
+			dirErrs = d.unpacker.UnpackAllFiles(dir)
+		}
+
+		for k, v := range dirErrs {
+			errs[k] = v
+		}
+	}
+
+	if len(errs) > 0 && d.Report != nil {
+		d.Report(errs)
+	}
+	return errs
+}
+
+// queueDir submits the archives inside dir as Bulk jobs to the queue and waits for them
+func (d *Daemon) queueDir(dir string) map[string]error {
+	accept := func(fname string) bool {
+		return isArchive(filepath.Join(dir, fname))
+	}
+	if d.Pattern != "" {
+		r, err := regexp.Compile(d.Pattern)
+		if err != nil {
+			return map[string]error{d.Pattern: err}
+		}
+		accept = r.MatchString
+	}
+
+	files, err := archivesInDir(dir, accept)
+	if err != nil {
+		return map[string]error{dir: err}
+	}
+
+	done := map[string]<-chan error{}
+	for _, file := range files {
+		done[file] = d.Queue.Submit(file, Bulk)
+	}
+
+	errs := map[string]error{}
+	for file, ch := range done {
+		if err := <-ch; err != nil {
+			errs[file] = err
+		}
+	}
+	return errs
+}
+
+// Run scans the directories at the times of the schedule (plus a random jitter) until ctx is done.
+// Scheduled times that are missed because a scan takes longer are skipped.
+func (d *Daemon) Run(ctx context.Context) error {
+	for {
+		next := d.Schedule.Next(time.Now())
+		if next.IsZero() {
+			return lib.ScheduleError(d.Schedule.String())
+		}
+
+		wait := time.Until(next)
+		if d.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(d.Jitter)))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+			d.Scan()
+			d.unpacker.ReleaseResources()
+		}
+	}
+}
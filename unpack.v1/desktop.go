@@ -0,0 +1,79 @@
+package unpack
+
+import (
+	"fmt"
+	"lib"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// DesktopNotify shows a desktop notification with the given title and message: with notify-send (D-Bus) on Linux
+// and the BSDs, with osascript on macOS and as toast via PowerShell on Windows.
+func DesktopNotify(title, message string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("osascript", "-e", "display notification "+appleScriptString(message)+" with title "+appleScriptString(title))
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript(title, message))
+	default:
+		cmd = exec.Command("notify-send", "--app-name=unpack", title, message)
+	}
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s: %s", err.Error(), msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// appleScriptString returns s as string literal of AppleScript
+func appleScriptString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// powerShellString returns s as single quoted string literal of PowerShell
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// toastScript returns the PowerShell script that shows a toast with the title and the message. The toast is shown
+// on behalf of PowerShell, since Windows only shows the toasts of registered applications.
+func toastScript(title, message string) string {
+	return `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] | Out-Null
+$t = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$n = $t.GetElementsByTagName('text')
+$n.Item(0).AppendChild($t.CreateTextNode(` + powerShellString(title) + `)) | Out-Null
+$n.Item(1).AppendChild($t.CreateTextNode(` + powerShellString(message) + `)) | Out-Null
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe').Show([Windows.UI.Notifications.ToastNotification]::new($t))`
+}
+
+// NotifyDesktop returns an Option that shows a desktop notification (see DesktopNotify), whenever the unpacking of an
+// archive file by UnpackFile, UnpackURL, UnpackFS or UnpackReader that took at least min has finished or failed,
+// e.g. "unpacked release.tgz" with the created directory or "failed to unpack release.tgz" with the error.
+// Errors of the notification are logged.
+// It is meant to be passed to New().
+func NotifyDesktop(min time.Duration) Option {
+	return func(c *config) {
+		c.addDone(func(j lib.Job) {
+			if j.Duration < min {
+				return
+			}
+
+			title, message := "unpacked "+filepath.Base(j.Archive), j.Dir
+			if j.Err != nil {
+				title, message = "failed to unpack "+filepath.Base(j.Archive), j.Err.Error()
+			}
+
+			if err := DesktopNotify(title, message); err != nil {
+				lib.LogError(&c.Options, "can't show desktop notification: "+err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package unpack
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"lib"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ToolTimeout is the time that a tool may take to report its version, see DiagnoseTools.
+var ToolTimeout = 5 * time.Second
+
+// versionArgs are the arguments that let the tools print their version, tools that are not listed get --version.
+// unrar and 7z print it as banner of their usage.
+var versionArgs = map[string][]string{
+	"unzip":      {"-v"},
+	"unrar":      {},
+	"7z":         {},
+	"uncompress": {"-V"},
+}
+
+// ToolStatus is the state of a tool that is run by the registered unpackers or testers, see DiagnoseTools.
+type ToolStatus struct {
+	Name string
+
+	// Path is the path of the tool inside the PATH, it is empty if the tool is missing
+	Path string
+
+	// Version is the first line that the tool printed about its version
+	Version string
+
+	// Extensions are the extensions whose unpackers or testers run the tool
+	Extensions []string
+
+	// Native is true, if all of the Extensions have a native unpacker, so that they can be unpacked
+	// without the tool (see Native)
+	Native bool
+
+	// Fallback is true, if the tool is only run, if the unpackers of the Extensions fail (see RegisterFallback)
+	Fallback bool
+
+	// Err is the error, if the tool is missing or can't be run
+	Err error
+}
+
+// Hint returns how to install a missing tool (see InstallHint) or "", if the tool is fine.
+func (t ToolStatus) Hint() string {
+	if t.Err == nil {
+		return ""
+	}
+	if t.Path == "" {
+		return InstallHint(t.Name)
+	}
+	return fmt.Sprintf("check that %s can be run", t.Path)
+}
+
+// DiagnoseTools checks that the tools of all registered unpackers, fallbacks and testers are inside the PATH and can be run,
+// so that batches don't fail halfway because a tool is missing. Each tool is asked for its version (with the
+// ToolTimeout). The tools are ordered by their names.
+func DiagnoseTools() []ToolStatus {
+	exts := map[string][]string{}
+	// the tools of the unpackers and testers are needed, the ones of the fallbacks are not
+	needed := map[string]bool{}
+	add := func(ext string, cmd string, need bool) {
+		for _, tool := range lib.CommandTools(cmd) {
+			if !contains(exts[tool], ext) {
+				exts[tool] = append(exts[tool], ext)
+			}
+			needed[tool] = needed[tool] || need
+		}
+	}
+
+	for _, cmds := range []map[string]string{lib.Unpackers(), lib.Testers()} {
+		for ext, cmd := range cmds {
+			add(ext, cmd, true)
+		}
+	}
+	for ext, cmds := range lib.Fallbacks() {
+		for _, cmd := range cmds {
+			add(ext, cmd, false)
+		}
+	}
+
+	tools := make([]ToolStatus, 0, len(exts))
+	for name, e := range exts {
+		sort.Strings(e)
+		t := ToolStatus{Name: name, Extensions: e, Native: true, Fallback: !needed[name]}
+		for _, ext := range e {
+			t.Native = t.Native && lib.HasNative(ext)
+		}
+		tools = append(tools, t)
+	}
+	sort.Slice(tools, func(i, j int) bool {
+		return tools[i].Name < tools[j].Name
+	})
+
+	var wg sync.WaitGroup
+	for i := range tools {
+		wg.Add(1)
+		go func(t *ToolStatus) {
+			defer wg.Done()
+			t.Path, t.Version, t.Err = toolVersion(t.Name)
+		}(&tools[i])
+	}
+	wg.Wait()
+	return tools
+}
+
+// FormatStatus is a registered unpacker with the availability of the tools of its command, see Formats.
+type FormatStatus struct {
+	Ext     string
+	Command string
+
+	// Missing are the tools of the Command that are not inside the PATH
+	Missing []string
+
+	// Native is true, if there is a native unpacker for Ext (see Native)
+	Native bool
+
+	// Aliases are the extensions that are handled like Ext, see AliasExtension
+	Aliases []string
+}
+
+// Available reports whether all tools of the Command are inside the PATH.
+func (f FormatStatus) Available() bool {
+	return len(f.Missing) == 0
+}
+
+// Formats returns the registered unpackers (see RegisteredUnpackers) ordered by their extensions. Other than
+// DiagnoseTools, the tools are only looked up inside the PATH and not run.
+func Formats() []FormatStatus {
+	unpackers := RegisteredUnpackers()
+	formats := make([]FormatStatus, 0, len(unpackers))
+	found := map[string]bool{}
+
+	aliases := map[string][]string{}
+	for alias, ext := range Aliases() {
+		aliases[ext] = append(aliases[ext], alias)
+	}
+
+	for ext, cmd := range unpackers {
+		f := FormatStatus{Ext: ext, Command: cmd, Native: lib.HasNative(ext), Aliases: aliases[ext]}
+		sort.Strings(f.Aliases)
+		for _, tool := range lib.CommandTools(cmd) {
+			has, known := found[tool]
+			if !known {
+				_, err := exec.LookPath(tool)
+				has = err == nil
+				found[tool] = has
+			}
+			if !has {
+				f.Missing = append(f.Missing, tool)
+			}
+		}
+		formats = append(formats, f)
+	}
+	sort.Slice(formats, func(i, j int) bool {
+		return formats[i].Ext < formats[j].Ext
+	})
+	return formats
+}
+
+// CheckTools is like DiagnoseTools, but just returns the errors of the tools by their names. The tools that
+// are fine have a nil error.
+func CheckTools() map[string]error {
+	errs := map[string]error{}
+	for _, t := range DiagnoseTools() {
+		errs[t.Name] = t.Err
+	}
+	return errs
+}
+
+// InstallHint returns how to install the missing tool, e.g. "install with 'apt install p7zip-full'" for 7z,
+// see ToolPackages.
+func InstallHint(tool string) string {
+	pkg := ToolPackages[tool]
+	if pkg == "" {
+		pkg = tool
+	}
+	return fmt.Sprintf("install with 'apt install %s'", pkg)
+}
+
+// toolVersion looks up the tool inside the PATH and returns its path and the first line that it prints about
+// its version. Tools that exit with an error are fine, as long as they could be run.
+func toolVersion(tool string) (path string, version string, err error) {
+	path, err = exec.LookPath(tool)
+	if err != nil {
+		return "", "", err
+	}
+
+	args, has := versionArgs[tool]
+	if !has {
+		args = []string{"--version"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ToolTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	var exit *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		return path, "", fmt.Errorf("%s did not respond within %s", tool, ToolTimeout)
+	case err != nil && !errors.As(err, &exit):
+		return path, "", err
+	}
+
+	for _, line := range strings.Split(string(bytes.TrimSpace(out)), "\n") {
+		if line = strings.Trim(line, "* \t\r"); line != "" {
+			return path, line, nil
+		}
+	}
+	return path, "", nil
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
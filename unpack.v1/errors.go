@@ -0,0 +1,235 @@
+package unpack
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"lib"
+	"os"
+)
+
+// Stable codes of the classes of errors, see ErrorCode.
+const (
+	CodeNoExtension      = "no_extension"
+	CodeUnknownFormat    = "unknown_format"
+	CodeCorruptArchive   = "corrupt_archive"
+	CodeCommandFailed    = "command_failed"
+	CodeNoExec           = "no_exec"
+	CodeIllegalPath      = "illegal_path"
+	CodeLongPath         = "long_path"
+	CodeLimitExceeded    = "limit_exceeded"
+	CodeTimeout          = "timeout"
+	CodeMissingVolume    = "missing_volume"
+	CodeClassMismatch    = "class_mismatch"
+	CodeExists           = "exists"
+	CodeProtectedDir     = "protected_dir"
+	CodeMkDirFailed      = "mkdir_failed"
+	CodeDownloadFailed   = "download_failed"
+	CodeUnknownSource    = "unknown_source"
+	CodeNotFound         = "not_found"
+	CodePermission       = "permission_denied"
+	CodeInvalidSchedule  = "invalid_schedule"
+	CodeInvalidTemplate  = "invalid_template"
+	CodeChecksumMismatch = "checksum_mismatch"
+	CodeBadSignature     = "bad_signature"
+	CodeInternal         = "internal"
+)
+
+// The errors of the unpacking. They may be wrapped, so match them with errors.As, e.g.
+//
+//	var run *unpack.RunError
+//	if errors.As(err, &run) {
+//		fmt.Println(run.Command, run.ExitCode, run.Stderr)
+//	}
+//
+// The errors with a string type are comparable and may also be matched with errors.Is, e.g.
+// errors.Is(err, unpack.UnknownPackerError(".foo")).
+type (
+	// RunError is the error of a command that failed. It has the exit code of the command and the end of its
+	// standard error output, Unwrap returns the underlying error (e.g. *exec.ExitError or a NoExecError).
+	RunError = lib.RunError
+
+	// NoExtensionError is the error of a file without extension
+	NoExtensionError = lib.NoExtensionError
+
+	// MkDirError is the error of a directory that could not be created
+	MkDirError = lib.MkDirError
+
+	// ExistsError is the error of a target that exists already
+	ExistsError = lib.ExistsError
+
+	// ProtectedDirError is the error of an archive inside a protected directory
+	ProtectedDirError = lib.ProtectedDirError
+
+	// UnknownPackerError, UnknownNativeError and UnknownTesterError are the errors of extensions
+	// without an unpacker, a native unpacker or a tester
+	UnknownPackerError = lib.UnknownPackerError
+	UnknownNativeError = lib.UnknownNativeError
+	UnknownTesterError = lib.UnknownTesterError
+
+	// UnpackerRegisteredError, TesterRegisteredError and SourceRegisteredError are the errors of
+	// registrations of extensions or URL schemes that are registered already
+	UnpackerRegisteredError = lib.UnpackerRegisteredError
+	TesterRegisteredError   = lib.TesterRegisteredError
+	SourceRegisteredError   = lib.SourceRegisteredError
+
+	// CorruptArchiveError is the error of an archive that failed the integrity test, Unwrap returns the cause
+	CorruptArchiveError = lib.CorruptArchiveError
+
+	// NoExecError is the error of a command on a platform that can't run commands
+	NoExecError = lib.NoExecError
+
+	// NoShellError is the error of a command that needs a shell on a system without one, see Shell
+	NoShellError = lib.NoShellError
+
+	// CommandsDisabledError is the error of a command that would be run although commands are disabled
+	CommandsDisabledError = lib.CommandsDisabledError
+
+	// IllegalPathError is the error of an archive entry outside of the target directory
+	IllegalPathError = lib.IllegalPathError
+
+	// LimitError and MemoryLimitError are the errors of exceeded limits, see MaxExtractedSize and DecoderMemoryLimit
+	LimitError       = lib.LimitError
+	MemoryLimitError = lib.MemoryLimitError
+
+	// TimeoutError and DeadlineError are the errors of extractions that took too long, see Timeout and Deadline.
+	// Archives that have not been started, because the deadline had passed, have a DeadlineError, too.
+	TimeoutError  = lib.TimeoutError
+	DeadlineError = lib.DeadlineError
+
+	// LongPathError is the error of an archive entry whose path would be too long
+	LongPathError = lib.LongPathError
+
+	// MissingVolumeError is the error of a multi-part archive without its first volume
+	MissingVolumeError = lib.MissingVolumeError
+
+	// DownloadError is the error of a failed download
+	DownloadError = lib.DownloadError
+
+	// UnknownSourceError is the error of an URL scheme without source
+	UnknownSourceError = lib.UnknownSourceError
+
+	// ScheduleError, TemplateError, SuffixError and GlobError are the errors of invalid schedules,
+	// dir templates, collision suffixes and globs
+	ScheduleError = lib.ScheduleError
+	TemplateError = lib.TemplateError
+	SuffixError   = lib.SuffixError
+	GlobError     = lib.GlobError
+
+	// ChecksumMismatchError is the error of an archive that does not match its checksum file
+	ChecksumMismatchError = lib.ChecksumMismatchError
+
+	// SignatureError is the error of an archive without a good signature, Unwrap returns the error of gpg
+	SignatureError = lib.SignatureError
+
+	// ClassMismatchError is the error of an unpacker that did not produce what its format class promises
+	ClassMismatchError = lib.ClassMismatchError
+)
+
+// ErrorCode returns the stable code of the class of err (one of the Code constants), so that clients can react
+// to errors without matching their messages. Errors that don't belong to a known class return CodeInternal,
+// nil returns "".
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var (
+		noExt       lib.NoExtensionError
+		unknown     lib.UnknownPackerError
+		unknownNat  lib.UnknownNativeError
+		unknownTest lib.UnknownTesterError
+		corrupt     *lib.CorruptArchiveError
+		run         *lib.RunError
+		noExec      lib.NoExecError
+		noShell     lib.NoShellError
+		disabled    lib.CommandsDisabledError
+		illegal     lib.IllegalPathError
+		longPath    *lib.LongPathError
+		limit       *lib.LimitError
+		memory      *lib.MemoryLimitError
+		timeout     *lib.TimeoutError
+		deadline    *lib.DeadlineError
+		volume      lib.MissingVolumeError
+		mismatch    *lib.ClassMismatchError
+		exists      lib.ExistsError
+		protected   lib.ProtectedDirError
+		mkdir       lib.MkDirError
+		download    *lib.DownloadError
+		source      lib.UnknownSourceError
+		schedule    lib.ScheduleError
+		template    lib.TemplateError
+		suffix      lib.SuffixError
+		glob        lib.GlobError
+		checksum    *lib.ChecksumMismatchError
+		signature   *lib.SignatureError
+	)
+
+	switch {
+	case errors.As(err, &noExt):
+		return CodeNoExtension
+	case errors.As(err, &unknown), errors.As(err, &unknownNat), errors.As(err, &unknownTest):
+		return CodeUnknownFormat
+	case errors.As(err, &checksum):
+		return CodeChecksumMismatch
+	case errors.As(err, &signature):
+		return CodeBadSignature
+	case errors.As(err, &corrupt), isFormatError(err):
+		return CodeCorruptArchive
+	case errors.As(err, &limit), errors.As(err, &memory):
+		return CodeLimitExceeded
+	case errors.As(err, &timeout), errors.As(err, &deadline):
+		return CodeTimeout
+	case errors.As(err, &illegal):
+		return CodeIllegalPath
+	case errors.As(err, &longPath):
+		return CodeLongPath
+	case errors.As(err, &noExec), errors.As(err, &noShell), errors.As(err, &disabled):
+		return CodeNoExec
+	case errors.As(err, &run):
+		return CodeCommandFailed
+	case errors.As(err, &volume):
+		return CodeMissingVolume
+	case errors.As(err, &mismatch):
+		return CodeClassMismatch
+	case errors.As(err, &exists):
+		return CodeExists
+	case errors.As(err, &protected):
+		return CodeProtectedDir
+	case errors.As(err, &mkdir):
+		return CodeMkDirFailed
+	case errors.As(err, &download):
+		return CodeDownloadFailed
+	case errors.As(err, &source):
+		return CodeUnknownSource
+	case errors.As(err, &schedule):
+		return CodeInvalidSchedule
+	case errors.As(err, &template), errors.As(err, &suffix), errors.As(err, &glob):
+		return CodeInvalidTemplate
+	case errors.Is(err, os.ErrNotExist):
+		return CodeNotFound
+	case errors.Is(err, os.ErrPermission):
+		return CodePermission
+	default:
+		return CodeInternal
+	}
+}
+
+// isFormatError reports whether err is an error of the native backend about a broken or truncated archive
+func isFormatError(err error) bool {
+	var (
+		structural bzip2.StructuralError
+		corrupt    flate.CorruptInputError
+	)
+
+	for _, e := range []error{zip.ErrFormat, zip.ErrChecksum, zip.ErrAlgorithm, gzip.ErrHeader, gzip.ErrChecksum, tar.ErrHeader, io.ErrUnexpectedEOF} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return errors.As(err, &structural) || errors.As(err, &corrupt)
+}
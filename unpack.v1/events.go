@@ -0,0 +1,89 @@
+package unpack
+
+import (
+	"encoding/json"
+	"io"
+	"lib"
+	"sync"
+	"time"
+)
+
+// Event is a step in the unpacking of an archive, see OnEvent.
+type Event = lib.Event
+
+// EventType is the kind of an Event.
+type EventType = lib.EventType
+
+// Types of an Event
+const (
+	EventStarted   = lib.EventStarted
+	EventExtracted = lib.EventExtracted
+	EventDone      = lib.EventDone
+	EventFailed    = lib.EventFailed
+)
+
+// OnEvent returns an Option that calls fn for every step in the unpacking of an archive file by UnpackFile, UnpackURL,
+// UnpackFS or UnpackReader: when it starts, for every extracted file, and when it is done or has failed.
+// The extracted files are reported after the archive has been extracted (by their paths inside the archive).
+// Several callbacks may be registered.
+// It is meant to be passed to New().
+func OnEvent(fn func(Event)) Option {
+	return func(c *config) {
+		prev := c.Events
+		if prev == nil {
+			c.Events = fn
+			return
+		}
+		c.Events = func(e lib.Event) {
+			prev(e)
+			fn(e)
+		}
+	}
+}
+
+// eventLine is the JSON representation of an Event, see WriteEvents
+type eventLine struct {
+	Time     time.Time `json:"time"`
+	Event    EventType `json:"event"`
+	Archive  string    `json:"archive"`
+	Entry    string    `json:"entry,omitempty"`
+	Size     *int64    `json:"size,omitempty"`
+	Dir      string    `json:"dir,omitempty"`
+	Files    *int64    `json:"files,omitempty"`
+	Bytes    *int64    `json:"bytes,omitempty"`
+	Duration *float64  `json:"duration,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Code     string    `json:"code,omitempty"`
+}
+
+// WriteEvents returns an Option that writes every Event (see OnEvent) as a line of JSON (NDJSON) to w, e.g.
+//
+//	{"time":"2024-05-01T10:00:00Z","event":"extracted","archive":"/data/release.tgz","entry":"release/README","size":1024}
+//
+// Events of type EventDone have the created dir, the number of files, the bytes and the duration in seconds,
+// events of type EventFailed the error and its code (see ErrorCode). Errors of w are ignored.
+// It is meant to be passed to New().
+func WriteEvents(w io.Writer) Option {
+	var mx sync.Mutex
+	enc := json.NewEncoder(w)
+
+	return OnEvent(func(e Event) {
+		l := eventLine{Time: e.Time, Event: e.Type, Archive: e.Archive, Entry: e.Entry}
+
+		switch e.Type {
+		case EventExtracted:
+			l.Size = &e.Size
+		case EventDone:
+			secs := e.Job.Duration.Seconds()
+			l.Dir, l.Files, l.Bytes, l.Duration = e.Job.Dir, &e.Job.Files, &e.Job.Bytes, &secs
+		case EventFailed:
+			secs := e.Job.Duration.Seconds()
+			l.Dir, l.Duration = e.Job.Dir, &secs
+			l.Error, l.Code = e.Job.Err.Error(), ErrorCode(e.Job.Err)
+		}
+
+		mx.Lock()
+		enc.Encode(l)
+		mx.Unlock()
+	})
+}
@@ -0,0 +1,93 @@
+package unpack
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/metakeule/unpack/unpack.v1/unpacktest"
+)
+
+// faultArchive registers the unpacker cmd (and the fallbacks) for the extension .flt and returns the path
+// of a new tar archive a.flt
+func faultArchive(t *testing.T, cmd string, fallbacks ...string) string {
+	t.Helper()
+	if err := RegisterUnpacker(".flt", cmd); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterUnpacker(".flt") })
+	for _, fb := range fallbacks {
+		if err := RegisterFallback(".flt", fb); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "a.flt")
+	writeTar(t, file, map[string]string{"a.txt": "a"})
+	return file
+}
+
+func TestFaultRestoreOnError(t *testing.T) {
+	file := faultArchive(t, "tar xf [FILE]")
+	restore := unpacktest.InjectFaults(unpacktest.Fault{Match: "^tar ", ExitCode: 2, Files: map[string]string{"a.txt": "par"}})
+	defer restore()
+
+	err := New(RestoreOnError).UnpackFile(file)
+
+	if code := ErrorCode(err); code != CodeCommandFailed {
+		t.Fatalf("expected the code %s, got %q (%v)", CodeCommandFailed, code, err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("the archive has not been moved back: %v", err)
+	}
+	if got := tree(t, filepath.Dir(file)); len(got) != 1 {
+		t.Errorf("the partial output has not been removed: %v", got)
+	}
+}
+
+func TestFaultFallback(t *testing.T) {
+	file := faultArchive(t, "flt-unpack [FILE]", "tar xf [FILE]")
+	restore := unpacktest.InjectFaults(unpacktest.Fault{Match: "^flt-unpack ", ExitCode: 127, Stderr: "flt-unpack: not found"})
+	defer restore()
+
+	if err := New().UnpackFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(file), "a", "a.txt")); err != nil {
+		t.Errorf("the fallback has not been run: %v", err)
+	}
+}
+
+func TestFaultTimes(t *testing.T) {
+	file := faultArchive(t, "tar xf [FILE]")
+	restore := unpacktest.InjectFaults(unpacktest.Fault{Match: "^tar ", Times: 1, ExitCode: 2})
+	defer restore()
+
+	u := New(RestoreOnError)
+	if err := u.UnpackFile(file); err == nil {
+		t.Fatal("the first run must fail")
+	}
+	if err := u.UnpackFile(file); err != nil {
+		t.Fatalf("the second run must run the command: %v", err)
+	}
+}
+
+func TestFaultHangTimeout(t *testing.T) {
+	file := faultArchive(t, "tar xf [FILE]")
+	restore := unpacktest.InjectFaults(unpacktest.Fault{Match: "^tar ", Hang: true})
+	defer restore()
+
+	start := time.Now()
+	err := New(Timeout(100*time.Millisecond), RestoreOnError).UnpackFile(file)
+
+	if code := ErrorCode(err); code != CodeTimeout {
+		t.Fatalf("expected the code %s, got %q (%v)", CodeTimeout, code, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("the hanging command has been killed after %s", d)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("the archive has not been moved back: %v", err)
+	}
+}
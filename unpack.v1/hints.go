@@ -0,0 +1,64 @@
+package unpack
+
+import (
+	"errors"
+	"lib"
+)
+
+// Hints maps the codes of the classes of errors (see ErrorCode) to short actionable hints, so that the command
+// line tool and services can tell their users how to fix a failure in the same words. The hints may be changed or
+// translated before anything is unpacked. Codes without a hint (like CodeInternal) have none.
+var Hints = map[string]string{
+	CodeNoExtension:      "rename the file so that it ends with the extension of its format, e.g. .tar.gz",
+	CodeUnknownFormat:    "the format is not supported, check the extension or register an unpacker for it",
+	CodeCorruptArchive:   "the archive is broken or truncated, download or copy it again",
+	CodeCommandFailed:    "see the output of the command above, formats with a native unpacker may be unpacked with --native",
+	CodeNoExec:           "running commands is not possible here, only .tar, .tar.gz, .tgz, .tar.bz2, .tbz2, .gz, .bz2 and .zip can be unpacked",
+	CodeIllegalPath:      "the archive tries to write outside of its directory and may be malicious, don't unpack it",
+	CodeLongPath:         "the paths are too long for this system, unpack into a shorter directory or change --long-paths",
+	CodeLimitExceeded:    "the archive exceeds the limits against archive bombs, raise --maxsize, --maxfiles or --maxratio if you trust it",
+	CodeTimeout:          "unpacking took too long, the tool may hang on a broken archive, raise --timeout or --total-timeout if it is just big",
+	CodeMissingVolume:    "put all volumes of the multi-part archive into the same directory",
+	CodeClassMismatch:    "the unpacker did not produce a single file, register the extension with another format class",
+	CodeExists:           "the target exists already, remove it or change --if-exists",
+	CodeProtectedDir:     "move the archive out of the protected directory before unpacking it",
+	CodeMkDirFailed:      "check that the directory is writable and the disk is not full",
+	CodeDownloadFailed:   "check the URL and the network connection and retry",
+	CodeUnknownSource:    "use an URL with a supported scheme like https:// or s3://",
+	CodeNotFound:         "check the path of the file",
+	CodePermission:       "check the permissions of the archive and of its directory",
+	CodeInvalidSchedule:  "use a cron expression like \"*/10 * * * *\" or an interval like \"@every 90s\"",
+	CodeInvalidTemplate:  "check the placeholders, e.g. {name}-{date} or {name}-{sha1:8}",
+	CodeChecksumMismatch: "the archive is not the expected one, download it again",
+	CodeBadSignature:     "the archive is not signed by a trusted key, don't unpack it or pass the keyring of the signer with --keyring",
+}
+
+// ToolPackages maps the commands of the unpackers to the names of their packages, if they differ, see InstallHint.
+var ToolPackages = map[string]string{
+	"7z":         "p7zip-full",
+	"xz":         "xz-utils",
+	"uncompress": "ncompress",
+}
+
+// Hint returns the hint of Hints for the class of err, e.g. "the archive is broken or truncated, download or copy
+// it again". If a command failed because it is not installed, the hint tells how to install it, e.g.
+// "unrar not found - install with 'apt install unrar'". Errors without a hint and nil return "".
+func Hint(err error) string {
+	if tool := MissingTool(err); tool != "" {
+		return tool + " not found - " + InstallHint(tool)
+	}
+	return Hints[ErrorCode(err)]
+}
+
+// MissingTool returns the name of the first tool that is not installed, if err is the error of a command that
+// failed (see CodeCommandFailed) because of it. Otherwise it returns "".
+func MissingTool(err error) string {
+	var run *lib.RunError
+	if ErrorCode(err) != CodeCommandFailed || !errors.As(err, &run) {
+		return ""
+	}
+	if missing := lib.MissingTools(run.Command); len(missing) > 0 {
+		return missing[0]
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package unpack
+
+import (
+	"bufio"
+	"encoding/json"
+	"lib"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status of a HistoryEntry
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+)
+
+// HistoryEntry is an unpacked archive inside the History.
+type HistoryEntry struct {
+	Time     time.Time     `json:"time"`
+	Archive  string        `json:"archive"`
+	Dir      string        `json:"dir,omitempty"`
+	Status   string        `json:"status"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// HistoryQuery filters the entries of the History. Empty fields match everything.
+type HistoryQuery struct {
+	// Status is StatusOK or StatusFailed
+	Status string
+
+	// Since and Until restrict the time of the entries
+	Since time.Time
+	Until time.Time
+
+	// Archive is a part of the path of the archive
+	Archive string
+}
+
+func (q HistoryQuery) matches(e *HistoryEntry) bool {
+	switch {
+	case q.Status != "" && q.Status != e.Status:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && e.Time.After(q.Until):
+		return false
+	case q.Archive != "" && !strings.Contains(e.Archive, q.Archive):
+		return false
+	default:
+		return true
+	}
+}
+
+// History is a persistent log of unpacked archives, so that one can find out later when an archive has
+// been unpacked and where. The entries are appended as JSON lines to a file.
+type History struct {
+	// Rotation decides when the file is rotated, Query only finds the entries of the current file
+	Rotation Rotation
+
+	file   string
+	mx     sync.Mutex
+	opened time.Time
+}
+
+// OpenHistory returns the History that is stored inside file. The file and its directory are created,
+// if they don't exist.
+func OpenHistory(file string) (*History, error) {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &History{file: file, opened: time.Now()}, f.Close()
+}
+
+// DefaultHistoryFile returns the default location of the History inside the configuration directory of the user.
+func DefaultHistoryFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "unpack", "history.jsonl"), nil
+}
+
+// Add appends the entry to the History.
+func (h *History) Add(e HistoryEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if finfo, err := os.Stat(h.file); err == nil && h.Rotation.due(finfo.Size(), len(b)+1, h.opened) {
+		err = h.Rotation.rotate(h.file)
+		if err != nil {
+			return err
+		}
+		h.opened = time.Now()
+	}
+
+	f, err := os.OpenFile(h.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Query returns the entries of the History that match q, the oldest first.
+func (h *History) Query(q HistoryQuery) ([]HistoryEntry, error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	f, err := os.Open(h.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []HistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		var e HistoryEntry
+		// skip broken lines, e.g. of a process that was killed while writing
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if q.matches(&e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries, sc.Err()
+}
+
+// record adds the job to the History, errors are logged
+func (h *History) record(j lib.Job, opts *lib.Options) {
+	e := HistoryEntry{
+		Time:     j.Start,
+		Archive:  j.Archive,
+		Dir:      j.Dir,
+		Status:   StatusOK,
+		Duration: j.Duration,
+	}
+
+	if j.Err != nil {
+		e.Status = StatusFailed
+		e.Error = j.Err.Error()
+	}
+
+	if err := h.Add(e); err != nil {
+		lib.LogError(opts, err.Error())
+	}
+}
+
+// RecordHistory returns an Option that adds every archive file that is unpacked by UnpackFile
+// (and therefore by UnpackAllFiles, UnpackFilesMatching, a Daemon and a Queue) to the History h.
+// It is meant to be passed to New().
+func RecordHistory(h *History) Option {
+	return func(c *config) {
+		c.addDone(func(j lib.Job) {
+			h.record(j, &c.Options)
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package unpack
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// operations of the entries of the journal of a Queue
+const (
+	opQueued = "queued"
+	opRetry  = "retry"
+	opDone   = "done"
+)
+
+// journalEntry is a line of the journal of a Queue
+type journalEntry struct {
+	Op       string     `json:"op"`
+	ID       int64      `json:"id"`
+	File     string     `json:"file,omitempty"`
+	Priority Priority   `json:"priority,omitempty"`
+	Attempt  int        `json:"attempt,omitempty"`
+	Next     *time.Time `json:"next,omitempty"`
+	Error    string     `json:"error,omitempty"`
+}
+
+// journal is the JSON lines file that a Queue appends the changes of its jobs to, see Queue.Persist
+type journal struct {
+	f *os.File
+}
+
+// openJournal reads the pending jobs of the journal file, compacts the file to them and opens it for appending.
+// The file and its directory are created, if they don't exist.
+func openJournal(file string) (*journal, []journalEntry, error) {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pending, err := readJournal(file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var buf bytes.Buffer
+	for _, e := range pending {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, nil, err
+		}
+		buf.Write(append(b, '\n'))
+	}
+
+	tmp := file + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), 0644)
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return nil, nil, err
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &journal{f: f}, pending, nil
+}
+
+// readJournal returns the jobs of the journal file that are not done, in the order of their submission
+func readJournal(file string) ([]journalEntry, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	jobs := map[int64]*journalEntry{}
+	var order []int64
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for sc.Scan() {
+		var e journalEntry
+		// skip the broken lines, e.g. the last line of a crashed process
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+
+		switch e.Op {
+		case opQueued:
+			jobs[e.ID] = &e
+			order = append(order, e.ID)
+		case opRetry:
+			if j := jobs[e.ID]; j != nil {
+				j.Attempt, j.Next, j.Error = e.Attempt, e.Next, e.Error
+			}
+		case opDone:
+			delete(jobs, e.ID)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []journalEntry
+	for _, id := range order {
+		if j := jobs[id]; j != nil {
+			pending = append(pending, *j)
+			delete(jobs, id)
+		}
+	}
+	return pending, nil
+}
+
+// add appends the entry to the journal. Failing writes don't stop the queue, they only lose the entry.
+func (j *journal) add(e journalEntry) {
+	if j == nil {
+		return
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	j.f.Write(append(b, '\n'))
+}
+
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
@@ -0,0 +1,50 @@
+package unpack
+
+import (
+	"lib"
+)
+
+// WhiteoutFormat decides how the whiteouts of layer archives are written, see LayerOutput.
+type WhiteoutFormat = lib.WhiteoutFormat
+
+const (
+	// WhiteoutsMetadata removes the whiteout entries from the layer and lists them in the file beside the
+	// layer directory with the extension WhiteoutsExt (see Whiteouts). This is the default.
+	WhiteoutsMetadata = lib.WhiteoutsMetadata
+
+	// WhiteoutsOverlay writes the layer as overlayfs upper directory: deleted entries become character devices
+	// with the device number 0/0 and opaque directories get the xattr trusted.overlay.opaque=y.
+	// It needs linux and the privileges to create devices and trusted xattrs (e.g. root).
+	WhiteoutsOverlay = lib.WhiteoutsOverlay
+
+	// WhiteoutsKeep keeps the whiteout entries of the archive (.wh.<name> and .wh..wh..opq) as they are.
+	WhiteoutsKeep = lib.WhiteoutsKeep
+)
+
+// WhiteoutsExt is the extension of the file beside a layer directory that lists its whiteouts as JSON,
+// e.g. layers/app.whiteouts.json for the layer layers/app.
+const WhiteoutsExt = lib.WhiteoutsExt
+
+// Whiteouts are the slash separated paths of the whiteouts of a layer, as written with WhiteoutsMetadata.
+type Whiteouts = lib.Whiteouts
+
+// LayerOutput returns an Option that makes every archive that is unpacked by UnpackFile, UnpackURL or UnpackFS
+// a layer inside dir, e.g. for building container images: the archive is extracted into a subdirectory of dir
+// that is named after it (see DirNameTemplate and OverwritePolicy), the archive stays where it is and the layout
+// of the archive is kept, i.e. nothing is flattened and RemoveDirectories is ignored.
+// The whiteouts of OCI layers (.wh.<name> marks a deleted entry and .wh..wh..opq an opaque directory) are
+// converted following LayerWhiteouts.
+// It is meant to be passed to New().
+func LayerOutput(dir string) Option {
+	return func(c *config) {
+		c.LayerDir = dir
+	}
+}
+
+// LayerWhiteouts returns an Option that sets the format of the whiteouts inside the layers, see LayerOutput.
+// It is meant to be passed to New().
+func LayerWhiteouts(format WhiteoutFormat) Option {
+	return func(c *config) {
+		c.Whiteouts = format
+	}
+}
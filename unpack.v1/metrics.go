@@ -0,0 +1,138 @@
+package unpack
+
+import (
+	"fmt"
+	"io"
+	"lib"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DurationBuckets are the upper bounds in seconds of the buckets of the histogram of the durations, see Metrics.
+var DurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// Metrics counts the archives that are unpacked by long running processes (see RecordMetrics) and exposes the numbers
+// as http.Handler in the text format of Prometheus, e.g. as /metrics:
+//
+//	unpack_archives_total{format}           the unpacked archives by their format (like Stats)
+//	unpack_failures_total{code}             the failed archives by the code of their error (see ErrorCode)
+//	unpack_extracted_files_total            the extracted files
+//	unpack_extracted_bytes_total            the extracted bytes
+//	unpack_duration_seconds                 histogram of the durations of the unpacking (see DurationBuckets)
+type Metrics struct {
+	mx       sync.Mutex
+	archives map[string]int64
+	failures map[string]int64
+	files    int64
+	bytes    int64
+
+	// buckets counts the durations per bucket of DurationBuckets, the last one is +Inf
+	buckets  []int64
+	duration time.Duration
+	count    int64
+}
+
+// NewMetrics returns empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{
+		archives: map[string]int64{},
+		failures: map[string]int64{},
+		buckets:  make([]int64, len(DurationBuckets)+1),
+	}
+}
+
+// record adds the job to the metrics
+func (m *Metrics) record(j lib.Job) {
+	format := strings.TrimPrefix(strings.ToLower(lib.Ext(j.Archive)), ".")
+	if format == "" {
+		format = "unknown"
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	m.archives[format]++
+	if j.Err != nil {
+		m.failures[ErrorCode(j.Err)]++
+	}
+	m.files += j.Files
+	m.bytes += j.Bytes
+
+	i := sort.SearchFloat64s(DurationBuckets, j.Duration.Seconds())
+	m.buckets[i]++
+	m.duration += j.Duration
+	m.count++
+}
+
+// WriteTo writes the metrics in the text format of Prometheus to w.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	var b strings.Builder
+
+	counter := func(name string, help string) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", name, help, name)
+	}
+
+	labeled := func(name string, label string, values map[string]int64) {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s{%s=%q} %d\n", name, label, k, values[k])
+		}
+	}
+
+	counter("unpack_archives_total", "Number of unpacked archives by format.")
+	labeled("unpack_archives_total", "format", m.archives)
+
+	counter("unpack_failures_total", "Number of archives that failed to unpack by error code.")
+	labeled("unpack_failures_total", "code", m.failures)
+
+	counter("unpack_extracted_files_total", "Number of extracted files.")
+	fmt.Fprintf(&b, "unpack_extracted_files_total %d\n", m.files)
+
+	counter("unpack_extracted_bytes_total", "Number of extracted bytes.")
+	fmt.Fprintf(&b, "unpack_extracted_bytes_total %d\n", m.bytes)
+
+	fmt.Fprintf(&b, "# HELP unpack_duration_seconds Duration of the unpacking of an archive.\n# TYPE unpack_duration_seconds histogram\n")
+	var cumulative int64
+	for i, le := range DurationBuckets {
+		cumulative += m.buckets[i]
+		fmt.Fprintf(&b, "unpack_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+	}
+	cumulative += m.buckets[len(DurationBuckets)]
+	fmt.Fprintf(&b, "unpack_duration_seconds_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(&b, "unpack_duration_seconds_sum %s\n", strconv.FormatFloat(m.duration.Seconds(), 'g', -1, 64))
+	fmt.Fprintf(&b, "unpack_duration_seconds_count %d\n", m.count)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP responds with the metrics in the text format of Prometheus.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// RecordMetrics returns an Option that adds every archive file that is unpacked by UnpackFile, UnpackURL, UnpackFS or
+// UnpackReader to m.
+// It is meant to be passed to New().
+func RecordMetrics(m *Metrics) Option {
+	return func(c *config) {
+		c.addDone(m.record)
+	}
+}
@@ -0,0 +1,94 @@
+package unpack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"lib"
+	"net/http"
+	"time"
+)
+
+// NotifyTimeout is the timeout of the requests of NotifyURL.
+var NotifyTimeout = 10 * time.Second
+
+// Notification is the JSON payload that NotifyURL posts to a webhook.
+type Notification struct {
+	Time    time.Time `json:"time"`
+	Archive string    `json:"archive"`
+
+	// Dir is the created directory (or file), it is empty if it could not be created
+	Dir string `json:"dir,omitempty"`
+
+	// Status is StatusOK or StatusFailed
+	Status string `json:"status"`
+
+	// Error and Code are the error of a failed archive and its code (see ErrorCode)
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+
+	Files    int64   `json:"files"`
+	Bytes    int64   `json:"bytes"`
+	Duration float64 `json:"duration"`
+}
+
+// NotifyURL returns an Option that posts a Notification as JSON to the webhook url, whenever the unpacking of an
+// archive file by UnpackFile, UnpackURL, UnpackFS or UnpackReader has finished, so that chat bots or pipelines can
+// react to it, e.g.
+//
+//	{"time":"2024-05-01T10:00:00Z","archive":"/data/release.tgz","dir":"/data/release","status":"ok","files":12,"bytes":40960,"duration":0.8}
+//
+// The request is sent before the unpacking returns (with the NotifyTimeout). If it fails or the webhook does not
+// respond with a 2xx status, the error is logged.
+// It is meant to be passed to New().
+func NotifyURL(url string) Option {
+	return func(c *config) {
+		c.addDone(func(j lib.Job) {
+			if err := notify(url, j); err != nil {
+				lib.LogError(&c.Options, fmt.Sprintf("can't notify %s: %s", url, err.Error()))
+			}
+		})
+	}
+}
+
+// notify posts the Notification of the job to url
+func notify(url string, j lib.Job) error {
+	n := Notification{
+		Time:     j.Start,
+		Archive:  j.Archive,
+		Dir:      j.Dir,
+		Status:   StatusOK,
+		Files:    j.Files,
+		Bytes:    j.Bytes,
+		Duration: j.Duration.Seconds(),
+	}
+
+	if j.Err != nil {
+		n.Status = StatusFailed
+		n.Error, n.Code = j.Err.Error(), ErrorCode(j.Err)
+	}
+
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "unpack")
+
+	client := &http.Client{Timeout: NotifyTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
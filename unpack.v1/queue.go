@@ -0,0 +1,230 @@
+package unpack
+
+import (
+	"sync"
+	"time"
+)
+
+// Priority is the lane of a job inside a Queue.
+type Priority int
+
+const (
+	// Bulk is the priority of background work, like the scans of a Daemon.
+	Bulk Priority = iota
+
+	// Interactive is the priority of user facing requests. They jump ahead of bulk jobs.
+	Interactive
+)
+
+// default concurrency limits of the lanes
+const (
+	defaultBulkLimit        = 1
+	defaultInteractiveLimit = 4
+)
+
+// maxBackoff is the maximal delay of a retry of a Queue
+const maxBackoff = time.Hour
+
+// Queue unpacks archive files in the background. Jobs are queued in lanes by their priority and each lane
+// has its own concurrency limit, so that interactive jobs don't have to wait for bulk jobs, e.g. when a service
+// uses unpack for both user facing and background work. See Persist for a queue that survives restarts.
+type Queue struct {
+	// Retries is the number of times that a failed job is retried before its error is returned.
+	// Only archives that are still at their place are retried, see RestoreOnError.
+	Retries int
+
+	// Backoff is the delay of the first retry of a failed job, it doubles with every further retry
+	// (up to an hour)
+	Backoff time.Duration
+
+	unpacker *config
+	mx       sync.Mutex
+	lanes    [Interactive + 1]lane
+	wg       sync.WaitGroup
+	journal  *journal
+	lastID   int64
+
+	// jobs are the jobs that are not done by their file, so that a file is not queued twice
+	jobs map[string]*job
+}
+
+type lane struct {
+	jobs    []*job
+	running int
+	limit   int
+}
+
+type job struct {
+	id       int64
+	file     string
+	priority Priority
+
+	// attempt is the number of failed attempts
+	attempt int
+
+	// waiters receive the error of the job, when it is done
+	waiters []chan error
+}
+
+// NewQueue returns a Queue that unpacks the files with the given options (see New). By default
+// one bulk job and four interactive jobs run at the same time, see SetLimit.
+func NewQueue(opts ...Option) *Queue {
+	q := &Queue{unpacker: New(opts...).(*config), jobs: map[string]*job{}}
+	q.lanes[Bulk].limit = defaultBulkLimit
+	q.lanes[Interactive].limit = defaultInteractiveLimit
+	return q
+}
+
+// SetLimit sets the maximal number of jobs with the given priority that run at the same time.
+// It panics, if limit is smaller than 1 or the priority is unknown.
+func (q *Queue) SetLimit(p Priority, limit int) {
+	if limit < 1 {
+		panic("limit must be at least 1")
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	q.lanes[p].limit = limit
+	q.dispatch()
+}
+
+// Submit queues the archive file with the given priority and returns a channel that receives
+// the error of UnpackFile, when the job is done (after the Retries). If the file is queued already,
+// the channel receives the error of the queued job.
+func (q *Queue) Submit(file string, p Priority) <-chan error {
+	done := make(chan error, 1)
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if j := q.jobs[file]; j != nil {
+		j.waiters = append(j.waiters, done)
+		return done
+	}
+
+	q.lastID++
+	j := &job{id: q.lastID, file: file, priority: p, waiters: []chan error{done}}
+	q.journal.add(journalEntry{Op: opQueued, ID: j.id, File: file, Priority: p})
+	q.wg.Add(1)
+	q.jobs[file] = j
+	q.lanes[p].jobs = append(q.lanes[p].jobs, j)
+	q.dispatch()
+	return done
+}
+
+// Persist backs the queue with the journal file (JSON lines), so that the queued jobs and the failed jobs that wait
+// for their retry survive restarts: the jobs of the journal that are not done are queued again (the retries at their
+// time) and every change of a job is appended to the journal. Since nobody waits for the jobs of the journal,
+// their errors are only recorded by the options, e.g. RecordHistory. The file and its directory are created,
+// if they don't exist. Persist must be called before any job is submitted.
+func (q *Queue) Persist(file string) error {
+	jn, pending, err := openJournal(file)
+	if err != nil {
+		return err
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.journal = jn
+	for _, e := range pending {
+		if e.ID > q.lastID {
+			q.lastID = e.ID
+		}
+
+		if e.Priority != Interactive {
+			e.Priority = Bulk
+		}
+
+		j := &job{id: e.ID, file: e.File, priority: e.Priority, attempt: e.Attempt}
+		q.wg.Add(1)
+		q.jobs[j.file] = j
+		if e.Next != nil && e.Next.After(time.Now()) {
+			q.retryAt(j, *e.Next)
+			continue
+		}
+		q.lanes[j.priority].jobs = append(q.lanes[j.priority].jobs, j)
+	}
+	q.dispatch()
+	return nil
+}
+
+// Close closes the journal of the queue, see Persist. It does not wait for the jobs.
+func (q *Queue) Close() error {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	err := q.journal.close()
+	q.journal = nil
+	return err
+}
+
+// Pending returns the number of jobs with the given priority that wait to be run.
+func (q *Queue) Pending(p Priority) int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+	return len(q.lanes[p].jobs)
+}
+
+// Wait waits until all submitted jobs are done.
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// dispatch starts the waiting jobs as far as the limits of their lanes allow it, interactive jobs first.
+// q.mx must be locked.
+func (q *Queue) dispatch() {
+	for p := Interactive; p >= Bulk; p-- {
+		l := &q.lanes[p]
+		for len(l.jobs) > 0 && l.running < l.limit {
+			j := l.jobs[0]
+			l.jobs = l.jobs[1:]
+			l.running++
+			go q.run(j)
+		}
+	}
+}
+
+func (q *Queue) run(j *job) {
+	err := q.unpacker.UnpackFile(j.file)
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.lanes[j.priority].running--
+
+	if err != nil && j.attempt < q.Retries && exists(j.file) {
+		j.attempt++
+		delay := q.Backoff
+		for i := 1; i < j.attempt && delay < maxBackoff; i++ {
+			delay *= 2
+		}
+		if delay > maxBackoff {
+			delay = maxBackoff
+		}
+
+		next := time.Now().Add(delay)
+		q.journal.add(journalEntry{Op: opRetry, ID: j.id, Attempt: j.attempt, Next: &next, Error: err.Error()})
+		q.retryAt(j, next)
+	} else {
+		q.journal.add(journalEntry{Op: opDone, ID: j.id})
+		delete(q.jobs, j.file)
+		for _, done := range j.waiters {
+			done <- err
+		}
+		q.wg.Done()
+	}
+
+	q.dispatch()
+}
+
+// retryAt queues the job again at the given time. q.mx must be locked.
+func (q *Queue) retryAt(j *job, at time.Time) {
+	time.AfterFunc(time.Until(at), func() {
+		q.mx.Lock()
+		defer q.mx.Unlock()
+
+		q.lanes[j.priority].jobs = append(q.lanes[j.priority].jobs, j)
+		q.dispatch()
+	})
+}
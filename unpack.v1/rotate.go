@@ -0,0 +1,192 @@
+package unpack
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rotation decides when a log file (the History or a RotatingFile, e.g. of the events) is rotated, so that
+// long running deployments don't fill their volume. The rotated file is compressed with gzip to a file beside it
+// that is named after the time of the rotation, e.g. history.jsonl.20240501T100000.000.gz.
+// The zero value never rotates.
+type Rotation struct {
+	// MaxSize is the size in bytes after which the file is rotated (0 = no limit)
+	MaxSize int64
+
+	// MaxAge is the time after which the file is rotated, measured from the time this process started to write
+	// to it (0 = no limit)
+	MaxAge time.Duration
+
+	// MaxBackups is the number of compressed files that are kept, the oldest are removed (0 = keep all)
+	MaxBackups int
+}
+
+// due reports whether a file of the given size that has been written to since opened must be rotated
+// before n more bytes are written
+func (r Rotation) due(size int64, n int, opened time.Time) bool {
+	if size == 0 {
+		return false
+	}
+	if r.MaxSize > 0 && size+int64(n) > r.MaxSize {
+		return true
+	}
+	return r.MaxAge > 0 && time.Since(opened) > r.MaxAge
+}
+
+// rotate compresses file into a backup beside it, removes file and the backups that are too many
+func (r Rotation) rotate(file string) error {
+	stamp := time.Now().Format("20060102T150405.000")
+	backup := file + "." + stamp + ".gz"
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s.%s-%d.gz", file, stamp, i)
+	}
+
+	err := gzipFile(file, backup)
+	if err != nil {
+		os.Remove(backup)
+		return err
+	}
+
+	err = os.Remove(file)
+	if err != nil {
+		return err
+	}
+
+	if r.MaxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(file + ".*.gz")
+	if err != nil {
+		return err
+	}
+
+	// the names sort by the time of the rotation
+	sort.Strings(backups)
+	for len(backups) > r.MaxBackups {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// gzipFile writes the compressed content of src to dst
+func gzipFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(src)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// RotatingFile is an io.WriteCloser that appends to a file and rotates it as given by its Rotation
+// before a write would exceed the limits. A single write is never split between two files.
+type RotatingFile struct {
+	file     string
+	rotation Rotation
+
+	mx     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+// OpenRotatingFile opens file for appending. The file and its directory are created, if they don't exist.
+func OpenRotatingFile(file string, r Rotation) (*RotatingFile, error) {
+	w := &RotatingFile{file: file, rotation: r}
+
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return w, w.open()
+}
+
+// open opens the file, w.mx must be held
+func (w *RotatingFile) open() error {
+	f, err := os.OpenFile(w.file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	finfo, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f, w.size, w.opened = f, finfo.Size(), time.Now()
+	return nil
+}
+
+// Write appends p to the file, after rotating it, if necessary.
+func (w *RotatingFile) Write(p []byte) (n int, err error) {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if w.rotation.due(w.size, len(p), w.opened) {
+		err = w.f.Close()
+		w.f = nil
+		if err == nil {
+			err = w.rotation.rotate(w.file)
+		}
+		// the file is opened again even if the rotation failed, the next write tries again
+		if oerr := w.open(); err == nil {
+			err = oerr
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the file.
+func (w *RotatingFile) Close() error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
@@ -0,0 +1,83 @@
+package unpack
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NoCommands is an Option that never runs the registered commands (and so never a shell) for unpacking.
+// Archives without a native unpacker fail with the code CodeNoExec (see ErrorCode). It implies Native.
+// It is meant to be passed to New().
+var NoCommands Option = func(c *config) {
+	c.PreferNative = true
+	c.NoCommands = true
+}
+
+// SecurityPreset is a bundle of the safety features, see SecurityLevel.
+type SecurityPreset int
+
+const (
+	// Relaxed trusts the archives: symlinks are kept, there are no limits and the commands are run.
+	// This is the default.
+	Relaxed SecurityPreset = iota
+
+	// Standard is meant for archives from the internet: only relative symlinks that point inside the unpacked
+	// directory are kept, paths that are too long fail, and archive bombs are stopped (a compression ratio
+	// above 1000, more than a million entries or decoders that need more than 1 GiB of memory).
+	Standard
+
+	// Paranoid is meant for hostile archives: no symlinks are kept, just the native backend is used (no
+	// commands and no shell, so formats without a native unpacker fail), and the limits are strict
+	// (a compression ratio above 100, more than 100000 entries, more than 10 GiB or decoders
+	// that need more than 256 MiB of memory).
+	Paranoid
+)
+
+func (s SecurityPreset) String() string {
+	switch s {
+	case Relaxed:
+		return "relaxed"
+	case Standard:
+		return "standard"
+	case Paranoid:
+		return "paranoid"
+	default:
+		return fmt.Sprintf("SecurityPreset(%d)", int(s))
+	}
+}
+
+// ParseSecurityPreset returns the SecurityPreset with the given name ("relaxed", "standard" or "paranoid").
+func ParseSecurityPreset(name string) (SecurityPreset, error) {
+	for _, s := range []SecurityPreset{Relaxed, Standard, Paranoid} {
+		if strings.EqualFold(name, s.String()) {
+			return s, nil
+		}
+	}
+	return Relaxed, fmt.Errorf("unknown security level: %#v", name)
+}
+
+// SecurityLevel returns an Option that sets the symlink policy, the policy for long paths, the limits against
+// archive bombs and whether commands are run as given by the preset, so that sensible protection does not require
+// to know all of these options. Entries that would end up outside of the unpacked directory are always refused.
+// Options that are passed after it to New() override the single settings.
+func SecurityLevel(preset SecurityPreset) Option {
+	return func(c *config) {
+		switch preset {
+		case Relaxed:
+			c.Symlinks = SymlinksAllow
+			c.LongPaths = LongPathsIgnore
+			c.MaxCompressionRatio, c.MaxFileCount, c.MaxExtractedSize, c.DecoderMemoryLimit = 0, 0, 0, 0
+			c.PreferNative, c.NoCommands = false, false
+		case Standard:
+			c.Symlinks = SymlinksRelativeOnly
+			c.LongPaths = LongPathsFail
+			c.MaxCompressionRatio, c.MaxFileCount, c.MaxExtractedSize, c.DecoderMemoryLimit = 1000, 1000000, 0, 1<<30
+			c.PreferNative, c.NoCommands = false, false
+		case Paranoid:
+			c.Symlinks = SymlinksSkip
+			c.LongPaths = LongPathsFail
+			c.MaxCompressionRatio, c.MaxFileCount, c.MaxExtractedSize, c.DecoderMemoryLimit = 100, 100000, 10<<30, 256<<20
+			c.PreferNative, c.NoCommands = true, true
+		}
+	}
+}
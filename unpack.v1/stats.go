@@ -0,0 +1,163 @@
+package unpack
+
+import (
+	"encoding/json"
+	"lib"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FormatStats are the accumulated numbers of the unpacked archives of a format.
+type FormatStats struct {
+	Archives int64         `json:"archives"`
+	Failed   int64         `json:"failed"`
+	Files    int64         `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+}
+
+// FailureRate returns the part of the archives that failed to unpack (0 to 1).
+func (f FormatStats) FailureRate() float64 {
+	if f.Archives == 0 {
+		return 0
+	}
+	return float64(f.Failed) / float64(f.Archives)
+}
+
+func (f *FormatStats) add(o FormatStats) {
+	f.Archives += o.Archives
+	f.Failed += o.Failed
+	f.Files += o.Files
+	f.Bytes += o.Bytes
+	f.Duration += o.Duration
+}
+
+// Stats are the statistics of the unpacked archives by their formats (the lower cased extension without
+// the leading dot, e.g. "tar.gz").
+type Stats struct {
+	Since   time.Time               `json:"since"`
+	Formats map[string]*FormatStats `json:"formats"`
+}
+
+// Total returns the sum of the statistics of all formats.
+func (s Stats) Total() (total FormatStats) {
+	for _, f := range s.Formats {
+		total.add(*f)
+	}
+	return
+}
+
+// StatsFile accumulates the Stats of the unpacked archives inside a local file, so that one can see
+// the own extraction patterns. Nothing is sent anywhere.
+type StatsFile struct {
+	file string
+	mx   sync.Mutex
+}
+
+// OpenStats returns the StatsFile that is stored inside file. The directory of the file is created,
+// if it doesn't exist.
+func OpenStats(file string) (*StatsFile, error) {
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &StatsFile{file: file}, nil
+}
+
+// DefaultStatsFile returns the default location of the StatsFile inside the configuration directory of the user.
+func DefaultStatsFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "unpack", "stats.json"), nil
+}
+
+// Read returns the accumulated Stats. They are empty, if nothing has been recorded yet.
+func (s *StatsFile) Read() (Stats, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.read()
+}
+
+// read reads the file, s.mx must be held
+func (s *StatsFile) read() (Stats, error) {
+	st := Stats{Formats: map[string]*FormatStats{}}
+
+	b, err := os.ReadFile(s.file)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+
+	err = json.Unmarshal(b, &st)
+	if st.Formats == nil {
+		st.Formats = map[string]*FormatStats{}
+	}
+	return st, err
+}
+
+// Add adds the numbers of an unpacked archive of the given format to the Stats.
+func (s *StatsFile) Add(format string, f FormatStats) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	st, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	if st.Since.IsZero() {
+		st.Since = time.Now()
+	}
+	if st.Formats[format] == nil {
+		st.Formats[format] = &FormatStats{}
+	}
+	st.Formats[format].add(f)
+
+	b, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.file + ".tmp"
+	err = os.WriteFile(tmp, b, 0644)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// record adds the job to the Stats, errors are logged
+func (s *StatsFile) record(j lib.Job, opts *lib.Options) {
+	f := FormatStats{Archives: 1, Files: j.Files, Bytes: j.Bytes, Duration: j.Duration}
+	if j.Err != nil {
+		f.Failed = 1
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(lib.Ext(j.Archive)), ".")
+	if format == "" {
+		format = "unknown"
+	}
+
+	if err := s.Add(format, f); err != nil {
+		lib.LogError(opts, err.Error())
+	}
+}
+
+// RecordStats returns an Option that adds every archive file that is unpacked by UnpackFile, UnpackURL, UnpackFS or
+// UnpackReader to the Stats of s.
+// It is meant to be passed to New().
+func RecordStats(s *StatsFile) Option {
+	return func(c *config) {
+		c.addDone(func(j lib.Job) {
+			s.record(j, &c.Options)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package unpack
+
+import (
+	"lib"
+)
+
+// Tracer starts spans, see Trace.
+type Tracer = lib.Tracer
+
+// Span is a timed phase of the unpacking of an archive, see Trace.
+type Span = lib.Span
+
+// Trace returns an Option that starts a span "unpack" (with the attribute "archive") for every archive file that is
+// unpacked by UnpackFile, UnpackURL, UnpackFS or UnpackReader and inside of it the spans of its phases:
+//
+//	download  the download of UnpackURL (attribute "url")
+//	command   the run of the unpacker command (attribute "command")
+//	native    the extraction with the native backend (attribute "entry")
+//	flatten   the flattening of the created directory
+//	cleanup   the removal of the archive files and of the RemoveDirectories
+//
+// The spans end with the error of their phase. OpenTelemetry is plugged in with a small adapter, e.g.
+//
+//	type otelSpan struct {
+//		ctx    context.Context
+//		tracer trace.Tracer
+//		span   trace.Span
+//	}
+//
+//	func (s otelSpan) Start(name string, attrs ...string) unpack.Span {
+//		var kvs []attribute.KeyValue
+//		for i := 0; i+1 < len(attrs); i += 2 {
+//			kvs = append(kvs, attribute.String(attrs[i], attrs[i+1]))
+//		}
+//		ctx, span := s.tracer.Start(s.ctx, name, trace.WithAttributes(kvs...))
+//		return otelSpan{ctx: ctx, tracer: s.tracer, span: span}
+//	}
+//
+//	func (s otelSpan) End(err error) {
+//		if err != nil {
+//			s.span.RecordError(err)
+//			s.span.SetStatus(codes.Error, err.Error())
+//		}
+//		s.span.End()
+//	}
+//
+// and unpack.New(unpack.Trace(otelSpan{ctx: ctx, tracer: otel.Tracer("unpack")})) makes the spans of the archives
+// children of the span of ctx.
+// It is meant to be passed to New().
+func Trace(t Tracer) Option {
+	return func(c *config) {
+		c.Tracer = t
+	}
+}
@@ -1,28 +1,109 @@
 package unpack
 
 import (
+	"bytes"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"lib"
+	"os"
 	"path/filepath"
 	"regexp"
+	"time"
 )
 
 func init() {
-	MustRegisterUnpacker(".tgz", "tar -xzf [FILE]")
-	MustRegisterUnpacker(".tar", "tar -xf [FILE]")
-	MustRegisterUnpacker(".zip", "unzip [FILE]")
-	MustRegisterUnpacker(".rar", "unrar x [FILE]")
-	MustRegisterUnpacker(".7z", "7z x [FILE]")
-	MustRegisterUnpacker(".gz", "gzip -d [FILE]")
+	MustRegisterUnpackerArgv(".tar", []string{"tar", "-xf", "[FILE]"})
+	MustRegisterUnpackerArgv(".zip", []string{"unzip", "[FILE]"})
+	MustRegisterUnpackerArgv(".rar", []string{"unrar", "x", "[FILE]"})
+	MustRegisterUnpackerArgv(".7z", []string{"7z", "x", "[FILE]"})
+	MustRegisterUnpackerArgv(".gz", []string{"gzip", "-d", "[FILE]"})
+	MustRegisterUnpackerArgv(".tar.gz", []string{"tar", "-xzf", "[FILE]"})
+	MustRegisterUnpackerArgv(".tar.bz2", []string{"tar", "-xjf", "[FILE]"})
+	MustRegisterUnpackerArgv(".tar.xz", []string{"tar", "-xJf", "[FILE]"})
+	MustRegisterUnpacker(".tar.zst", "zstd -dc [FILE] | tar -xf -")
+	MustRegisterUnpacker(".tar.lz4", "lz4 -dc [FILE] | tar -xf -")
+	MustRegisterUnpacker(".tar.lzma", "xz --format=lzma -dc [FILE] | tar -xf -")
+	MustRegisterUnpacker(".tar.Z", "uncompress -c [FILE] | tar -xf -")
+	MustRegisterUnpackerArgv(".xz", []string{"xz", "-d", "[FILE]"})
+	MustRegisterUnpackerArgv(".bz2", []string{"bzip2", "-d", "[FILE]"})
+	MustRegisterUnpackerArgv(".zst", []string{"zstd", "-d", "-q", "--rm", "[FILE]"})
+	MustRegisterUnpackerArgv(".lz4", []string{"lz4", "-d", "-m", "-q", "--rm", "[FILE]"})
+	MustRegisterUnpackerArgv(".lzma", []string{"xz", "--format=lzma", "-d", "[FILE]"})
+	MustRegisterUnpackerArgv(".Z", []string{"uncompress", "[FILE]"})
+
+	MustRegisterFallbackArgv(".rar", []string{"7z", "x", "[FILE]"})
+	MustRegisterFallbackArgv(".rar", []string{"bsdtar", "-xf", "[FILE]"})
+	MustRegisterFallbackArgv(".zip", []string{"7z", "x", "[FILE]"})
+	MustRegisterFallbackArgv(".zip", []string{"bsdtar", "-xf", "[FILE]"})
+	MustRegisterFallbackArgv(".7z", []string{"bsdtar", "-xf", "[FILE]"})
+
+	MustRegisterTester(".tar", "tar -tf [FILE] > /dev/null")
+	MustRegisterTesterArgv(".zip", []string{"unzip", "-tq", "[FILE]"})
+	MustRegisterTesterArgv(".rar", []string{"unrar", "t", "[FILE]"})
+	MustRegisterTesterArgv(".7z", []string{"7z", "t", "[FILE]"})
+	MustRegisterTesterArgv(".gz", []string{"gzip", "-t", "[FILE]"})
+	MustRegisterTester(".tar.gz", "tar -tzf [FILE] > /dev/null")
+	MustRegisterTester(".tar.bz2", "tar -tjf [FILE] > /dev/null")
+	MustRegisterTester(".tar.xz", "tar -tJf [FILE] > /dev/null")
+	MustRegisterTesterArgv(".tar.zst", []string{"zstd", "-t", "-q", "[FILE]"})
+	MustRegisterTesterArgv(".tar.lz4", []string{"lz4", "-t", "-q", "[FILE]"})
+	MustRegisterTesterArgv(".tar.lzma", []string{"xz", "--format=lzma", "-t", "[FILE]"})
+	MustRegisterTesterArgv(".tar.Z", []string{"gzip", "-t", "[FILE]"})
+	MustRegisterTesterArgv(".xz", []string{"xz", "-t", "[FILE]"})
+	MustRegisterTesterArgv(".bz2", []string{"bzip2", "-t", "[FILE]"})
+	MustRegisterTesterArgv(".zst", []string{"zstd", "-t", "-q", "[FILE]"})
+	MustRegisterTesterArgv(".lz4", []string{"lz4", "-t", "-q", "[FILE]"})
+	MustRegisterTesterArgv(".lzma", []string{"xz", "--format=lzma", "-t", "[FILE]"})
+	MustRegisterTesterArgv(".Z", []string{"gzip", "-t", "[FILE]"})
+
+	MustRegisterSource("s3", CommandSource("aws s3 cp [URL] -"))
+	MustRegisterSource("gs", CommandSource("gcloud storage cat [URL]"))
+	// az can't write the blob to its standard output (and /dev/stdout is not available everywhere)
+	MustRegisterSource("az", DownloadSource("az storage blob download --blob-url https://[HOST].blob.core.windows.net/[PATH] --auth-mode login --no-progress --output none --file [FILE]"))
 }
 
 // RegisterUnpacker registers the given cmd for the given extension ext.
-// ext must start with "." like e.g. ".zip"
-// cmd must contain [FILE] placeholder for filename, e.g. "unzip [FILE]"
+// ext must start with "." like e.g. ".zip" and may be a compound extension like ".tar.gz"
+// that takes precedence over the last extension (".gz") of a file.
+// cmd must contain [FILE] placeholder for filename, e.g. "unzip [FILE]".
+// If there is an unpacker for ext already, an UnpackerRegisteredError is returned, unless OverrideAllowed is set.
 func RegisterUnpacker(ext string, cmd string) error {
+	if OverrideAllowed {
+		return lib.ReplaceUnpacker(ext, cmd)
+	}
 	return lib.RegisterUnpacker(ext, cmd)
 }
 
+// RegisteredUnpackers returns the command templates of the registered unpackers by their extensions,
+// e.g. "tar -xzf [FILE]" for ".tgz", see Formats.
+func RegisteredUnpackers() map[string]string {
+	return lib.Unpackers()
+}
+
+// OverrideAllowed lets RegisterUnpacker and RegisterUnpackerArgv replace the unpackers that are registered already,
+// e.g. the default ones, instead of returning an UnpackerRegisteredError. It should be set before anything is unpacked.
+var OverrideAllowed = false
+
+// ReplaceUnpacker is like RegisterUnpacker, but replaces the unpacker of ext, if there is one, e.g.
+// ReplaceUnpacker(".zip", "7z x [FILE]") instead of unzip. The fallbacks of ext (see RegisterFallback) are kept.
+func ReplaceUnpacker(ext string, cmd string) error {
+	return lib.ReplaceUnpacker(ext, cmd)
+}
+
+// ReplaceUnpackerArgv is like ReplaceUnpacker, but the command is given by its arguments and run without shell,
+// see RegisterUnpackerArgv.
+func ReplaceUnpackerArgv(ext string, argv []string) error {
+	return lib.ReplaceUnpackerArgv(ext, argv)
+}
+
+// UnregisterUnpacker removes the unpacker of ext and its fallbacks, so that files with the extension are
+// unpacked natively (see Native), if there is a native unpacker, or are refused with an UnknownPackerError.
+// It returns an UnknownPackerError, if there is no unpacker for ext.
+func UnregisterUnpacker(ext string) error {
+	return lib.UnregisterUnpacker(ext)
+}
+
 // MustRegisterUnpacker is like RegisterUnpacker but panicks if there is an error.
 func MustRegisterUnpacker(ext string, cmd string) {
 	err := RegisterUnpacker(ext, cmd)
@@ -31,36 +112,873 @@ func MustRegisterUnpacker(ext string, cmd string) {
 	}
 }
 
+// RegisterTester registers the given cmd as integrity tester for the given extension ext.
+// ext must start with "." like e.g. ".zip"
+// cmd must contain [FILE] placeholder for filename, e.g. "unzip -tq [FILE]" and must
+// exit with a non zero exit code if the archive is corrupt.
+func RegisterTester(ext string, cmd string) error {
+	return lib.RegisterTester(ext, cmd)
+}
+
+// MustRegisterTester is like RegisterTester but panicks if there is an error.
+func MustRegisterTester(ext string, cmd string) {
+	err := RegisterTester(ext, cmd)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterFallback registers cmd as fallback of the unpacker for the extension ext, which must be registered already.
+// If the unpacker command fails, e.g. because its tool is not installed, the leftovers of the command are removed
+// and the fallbacks are tried in the order of their registration, e.g. unrar, 7z and bsdtar for ".rar" (the
+// default). The command that has been run is reported as Command of the Job. cmd must contain the [FILE] placeholder.
+// Fallbacks are not tried, if a limit stopped the command or a decompressor has removed the archive.
+func RegisterFallback(ext string, cmd string) error {
+	return lib.RegisterFallback(ext, cmd)
+}
+
+// MustRegisterFallback is like RegisterFallback but panicks if there is an error.
+func MustRegisterFallback(ext string, cmd string) {
+	err := RegisterFallback(ext, cmd)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterFallbackArgv is like RegisterFallback, but the command is given by its arguments and run without shell,
+// see RegisterUnpackerArgv.
+func RegisterFallbackArgv(ext string, argv []string) error {
+	return lib.RegisterFallbackArgv(ext, argv)
+}
+
+// MustRegisterFallbackArgv is like RegisterFallbackArgv but panicks if there is an error.
+func MustRegisterFallbackArgv(ext string, argv []string) {
+	err := RegisterFallbackArgv(ext, argv)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterUnpackerArgv is like RegisterUnpacker, but the command is given by its arguments, e.g.
+// []string{"tar", "-xzf", "[FILE]"}, and run directly instead of by a shell, so that file names need no quoting
+// and no shell is required. Commands that need the features of a shell (like pipes) are registered with
+// RegisterUnpacker, see Shell.
+func RegisterUnpackerArgv(ext string, argv []string) error {
+	if OverrideAllowed {
+		return lib.ReplaceUnpackerArgv(ext, argv)
+	}
+	return lib.RegisterUnpackerArgv(ext, argv)
+}
+
+// MustRegisterUnpackerArgv is like RegisterUnpackerArgv but panicks if there is an error.
+func MustRegisterUnpackerArgv(ext string, argv []string) {
+	err := RegisterUnpackerArgv(ext, argv)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// RegisterTesterArgv is like RegisterTester, but the command is given by its arguments, e.g.
+// []string{"gzip", "-t", "[FILE]"}, and run directly instead of by a shell.
+func RegisterTesterArgv(ext string, argv []string) error {
+	return lib.RegisterTesterArgv(ext, argv)
+}
+
+// MustRegisterTesterArgv is like RegisterTesterArgv but panicks if there is an error.
+func MustRegisterTesterArgv(ext string, argv []string) {
+	err := RegisterTesterArgv(ext, argv)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// AliasExtension lets the extension from be handled like the extension to (or the extension that to is an alias
+// of), i.e. by its unpacker, native unpacker, tester, fallbacks and class, without duplicating the registrations,
+// e.g. AliasExtension(".cbz", ".zip"). Registrations for from apply to to afterwards. By default ".tgz", ".tbz2",
+// ".tbz", ".tb2", ".txz", ".tzst", ".taz", ".cbz", ".cbr", ".cb7" and ".cbt" are aliases. An UnpackerRegisteredError
+// is returned, if from has registrations of its own.
+func AliasExtension(from string, to string) error {
+	return lib.AliasExtension(from, to)
+}
+
+// MustAliasExtension is like AliasExtension but panicks if there is an error.
+func MustAliasExtension(from string, to string) {
+	err := AliasExtension(from, to)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// Aliases returns the extensions that the aliases are handled like, by the aliases, e.g. ".tar.gz" for ".tgz",
+// see AliasExtension.
+func Aliases() map[string]string {
+	return lib.Aliases()
+}
+
+// RegisterDetector binds the unpacker of the extension ext (which must be registered already) to the files for
+// which detect returns true, so that files without a known extension are unpacked, too, e.g. files without
+// extension, version-suffixed names like backup.zip.1 or files that are routed by their magic number (see
+// MagicDetector). detect gets the path of the file, the detectors are asked in the order of their registration.
+// Since the commands expect the extension, it is appended to the name of the file before it is unpacked (and
+// removed again, if unpacking fails).
+func RegisterDetector(ext string, detect func(path string) bool) error {
+	return lib.RegisterDetector(ext, detect)
+}
+
+// MustRegisterDetector is like RegisterDetector but panicks if there is an error.
+func MustRegisterDetector(ext string, detect func(path string) bool) {
+	err := RegisterDetector(ext, detect)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// MagicDetector returns a detector for RegisterDetector that detects the files that have the given magic number at
+// the given offset, e.g. MagicDetector(0, []byte("PK\x03\x04")) for zips.
+func MagicDetector(offset int64, magic []byte) func(path string) bool {
+	return func(path string) bool {
+		f, err := os.Open(path)
+		if err != nil {
+			return false
+		}
+		defer f.Close()
+
+		head := make([]byte, len(magic))
+		_, err = f.ReadAt(head, offset)
+		return err == nil && bytes.Equal(head, magic)
+	}
+}
+
+// Shell returns an Option that runs the commands that have been registered as command lines (see RegisterUnpacker
+// and RegisterTester) with the shell at path, which is called with -c, e.g. "/bin/bash" for commands that
+// need its features. By default /bin/sh (or the sh in the PATH) is used. Commands that have been registered
+// with RegisterUnpackerArgv or RegisterTesterArgv are always run without shell.
+// It is meant to be passed to New().
+func Shell(path string) Option {
+	return func(c *config) {
+		c.Options.Shell = path
+	}
+}
+
+// FormatClass tells whether the unpacker of a format produces a tree of files or a single file.
+type FormatClass = lib.FormatClass
+
+const (
+	// ClassArchive is the class of archivers like tar and zip that produce a tree of files.
+	// This is the default for registered unpackers.
+	ClassArchive = lib.ClassArchive
+
+	// ClassCompressor is the class of decompressors like gzip and xz that produce a single file
+	// (".gz", ".bz2", ".xz", ".zst", ".lz4", ".lzma", ".Z").
+	ClassCompressor = lib.ClassCompressor
+)
+
+// RegisterFormatClass sets the class of the format with the given extension, e.g. ClassCompressor for the
+// registered unpacker of a decompressor. Archives are flattened, while the single file of a decompressor is not
+// (see SingleFile). If a decompressor does not produce a single file, unpacking fails instead of guessing.
+func RegisterFormatClass(ext string, class FormatClass) error {
+	return lib.RegisterClass(ext, class)
+}
+
+// FormatClassOf returns the class of the format with the given extension.
+func FormatClassOf(ext string) FormatClass {
+	return lib.ClassOf(ext)
+}
+
+// Info describes what unpacking an archive file would produce, see Inspect.
+type Info = lib.Info
+
+// Inspect returns what unpacking the archive file would produce without extracting it: the class of its format,
+// whether it is a compressed tar, whether it yields a single file or a tree, the name of the created directory and
+// whether it would be flattened. The top level entries, the number of entries and the uncompressed size (and so
+// the compression ratio, see Info.Ratio) are listed for the formats of the native backend
+// (".tar",".tgz",".tar.gz",".zip",".gz",".bz2",".tbz2",".tbz",".tar.bz2"), see Info.Listed.
+func Inspect(file string) (*Info, error) {
+	return lib.Inspect(file)
+}
+
+// OpenEntry returns the decompressed content of the regular file entry (a slash separated path) inside the archive
+// file, e.g. OpenEntry("backup.tgz", "etc/config.yml"), without extracting anything else. Tars and zips are read
+// natively, the file of a decompressor is named like the unpacked file (foo for foo.gz) and other archives are
+// extracted by their command into a temporary directory that is removed on Close.
+// An error that wraps fs.ErrNotExist is returned, if there is no such file inside the archive.
+func OpenEntry(file string, entry string) (io.ReadCloser, error) {
+	return lib.OpenEntry(file, entry, &lib.Options{LogLevel: -1})
+}
+
+// Source fetches the archive at the given URL, see RegisterSource.
+type Source = lib.Source
+
+// RegisterSource registers the given source for the given URL scheme, so that UnpackFile accepts URLs like
+// "s3://bucket/key.tgz". By default there are sources for http, https, sftp and ssh (sftp://user@host/path,
+// fetched via ssh), s3 (aws), gs (gcloud) and az (az://account/container/blob). Sources for other schemes may be written with the SDK of the provider
+// or be built from a command (see CommandSource).
+func RegisterSource(scheme string, src Source) error {
+	return lib.RegisterSource(scheme, src)
+}
+
+// MustRegisterSource is like RegisterSource but panicks if there is an error.
+func MustRegisterSource(scheme string, src Source) {
+	err := RegisterSource(scheme, src)
+	if err != nil {
+		panic(err.Error())
+	}
+}
+
+// CommandSource returns a Source that runs cmd in a subshell and streams the archive from its standard output.
+// The placeholders [URL], [HOST] and [PATH] inside cmd are replaced by the URL, its host and its path
+// without the leading slash, e.g. "aws s3 cp [URL] -". The command line tools of the cloud providers
+// use their standard credential chains.
+func CommandSource(cmd string) Source {
+	return lib.CommandSource(cmd)
+}
+
+// DownloadSource is like CommandSource, but for tools that can't write the archive to their standard output:
+// cmd downloads it to the temporary file [FILE] instead, e.g. "az storage blob download ... --file [FILE]".
+// The file is removed after the archive has been read.
+func DownloadSource(cmd string) Source {
+	return lib.DownloadSource(cmd)
+}
+
+// TestBeforeUnpack is an Option that tests the integrity of the archive file before it is moved
+// and unpacked. Corrupt archives are left untouched.
+// It is meant to be passed to New().
+var TestBeforeUnpack Option = func(c *config) {
+	c.testArchive = true
+}
+
+// Native is an Option that prefers the native backend, i.e. archives are extracted within the process
+// instead of running the registered command in a subshell. It only affects extensions for which a native
+// unpacker exists: ".tgz",".tar.gz",".tar",".zip",".gz",".bz2",".tbz2",".tbz",".tar.bz2"
+// On platforms without support for running commands (js/wasm, wasip1) and inside restricted environments
+// (see Restricted) the native backend is always used.
+// It is meant to be passed to New().
+var Native Option = func(c *config) {
+	c.PreferNative = true
+}
+
+// ToolConcurrency returns an Option that limits the number of unpacker commands that run a tool at the same time,
+// by the name of the tool, e.g. map[string]int{"7z": 1, "unzip": 4}, so that batches (see Queue) don't oversubscribe
+// the CPUs with tools that are multithreaded themselves. Commands with pipes count for each of their tools.
+// Tools without a limit are not limited. The limits are shared by all unpackers that are created with the returned Option.
+// It is meant to be passed to New().
+func ToolConcurrency(limits map[string]int) Option {
+	t := lib.NewToolLimits(limits)
+	return func(c *config) {
+		c.Tools = t
+	}
+}
+
+// MaxCPU returns an Option that limits the number of goroutines of the native backend that decompress at the same
+// time to n (at least 1), independent of GOMAXPROCS, so that unpacking inside latency sensitive services doesn't
+// take all cores, e.g. with a Queue. Extractions wait for a free slot. The limit is shared by all unpackers
+// that are created with the returned Option.
+// It is meant to be passed to New().
+func MaxCPU(n int) Option {
+	w := lib.NewWorkers(n)
+	return func(c *config) {
+		c.Workers = w
+	}
+}
+
+// ZipConcurrency returns an Option that extracts the files of a zip with up to n goroutines in parallel (native
+// backend only), since the central directory of zips allows to read them independently. This speeds up single huge
+// zips on fast disks. The directories are created first, of entries with the same name the last one wins, like it
+// does when extracting serially, and zips with symlinks are always extracted serially. With MaxCPU the
+// additional goroutines are only started as far as the limit allows it.
+// It is meant to be passed to New().
+func ZipConcurrency(n int) Option {
+	return func(c *config) {
+		c.ZipWorkers = n
+	}
+}
+
+// Decompressors returns the command lines of the parallel decompressors that have been found inside the PATH by
+// their formats: pigz for "gzip", pbzip2 for "bzip2", pixz or xz -T0 for "xz" and zstd -T0 for "zstd". They are
+// preferred over the single-threaded tools by the commands of the corresponding extensions (also when tar
+// decompresses, e.g. .tgz), which speeds up large archives on machines with many cores. Formats without a parallel
+// decompressor have an empty command line.
+func Decompressors() map[string]string {
+	return lib.Decompressors()
+}
+
+// Decompressor returns an Option that pins the decompressor of the format ("gzip", "bzip2", "xz" or "zstd", see
+// Decompressors) to the given command line, e.g. Decompressor("xz", "xz -T0") instead of pixz. The name of the
+// format, e.g. Decompressor("gzip", "gzip"), keeps the single-threaded tool.
+// It is meant to be passed to New().
+func Decompressor(format string, cmd string) Option {
+	return func(c *config) {
+		d := make(map[string]string, len(c.Decompressors)+1)
+		for f, cmd := range c.Decompressors {
+			d[f] = cmd
+		}
+		d[format] = cmd
+		c.Decompressors = d
+	}
+}
+
+// Restricted reports whether the process runs inside a restricted environment like Termux (Android)
+// or a-Shell (iOS), on a platform without support for running commands or on a system without a shell.
+// Inside restricted environments the native backend is preferred and temporary files are
+// placed in TempDir().
+func Restricted() bool {
+	return lib.Restricted()
+}
+
+// TempDir returns the directory that is used for temporary files.
+func TempDir() string {
+	return lib.TempDir()
+}
+
+// SymlinkPolicy decides which symbolic links inside archives are kept.
+type SymlinkPolicy = lib.SymlinkPolicy
+
+const (
+	// SymlinksAllow keeps all symbolic links. This is the default.
+	SymlinksAllow = lib.SymlinksAllow
+
+	// SymlinksRelativeOnly keeps only relative symbolic links that point inside the unpacked directory.
+	SymlinksRelativeOnly = lib.SymlinksRelativeOnly
+
+	// SymlinksSkip does not keep any symbolic link.
+	SymlinksSkip = lib.SymlinksSkip
+)
+
+// Symlinks returns an Option that sets the policy for symbolic links inside archives.
+// Malicious archives may contain symbolic links that point outside of the unpacked directory and
+// write files through them. The native backend does not create links that are not allowed by the policy
+// and refuses to write through them. Since external commands can't be controlled that way, after
+// they ran the unpacked directory is audited and all links that are not allowed by the policy are removed.
+// It is meant to be passed to New().
+func Symlinks(policy SymlinkPolicy) Option {
+	return func(c *config) {
+		c.Symlinks = policy
+	}
+}
+
+// ExistsPolicy decides what happens if the directory for an archive already exists.
+type ExistsPolicy = lib.ExistsPolicy
+
+const (
+	// IfExistsRename creates the directory with a suffix like -1, -2, ... This is the default.
+	// A file that collides with the archive while flattening is kept and the archive gets the suffix.
+	IfExistsRename = lib.ExistsRename
+
+	// IfExistsSkip does not unpack the archive and does not flatten, if files would collide.
+	IfExistsSkip = lib.ExistsSkip
+
+	// IfExistsOverwrite removes the existing directory (or the colliding file while flattening).
+	IfExistsOverwrite = lib.ExistsOverwrite
+
+	// IfExistsFail returns an error.
+	IfExistsFail = lib.ExistsFail
+)
+
+// OverwritePolicy returns an Option that sets the policy for an existing directory of an archive and for
+// files that collide with the archive file when the unpacked directory is flattened.
+// It is meant to be passed to New().
+func OverwritePolicy(policy ExistsPolicy) Option {
+	return func(c *config) {
+		c.IfExists = policy
+	}
+}
+
+// SuffixStrategy decides how the names of existing directories and files are varied with IfExistsRename,
+// see CollisionSuffix.
+type SuffixStrategy = lib.SuffixStrategy
+
+// CollisionSuffix returns an Option that varies the names of existing directories (and files that collide while
+// flattening) following the strategy s instead of trying the suffixes -1, -2, ... -10, e.g.
+// SuffixStrategy{Timestamp: "-20060102-150405"} or SuffixStrategy{Format: " (%d)", MaxTries: -1} for unlimited tries.
+// If the tries are exhausted, the unpacking fails. An invalid strategy (see SuffixStrategy.Check) makes the unpacking fail, too.
+// It is meant to be passed to New().
+func CollisionSuffix(s SuffixStrategy) Option {
+	return func(c *config) {
+		c.Suffix = s
+	}
+}
+
+// ProtectedDirs returns an Option that adds dirs to the protected directories. Nothing is unpacked inside of them,
+// so that running unpack in the wrong directory does no harm. By default the root of the filesystem and the system
+// directories (like /usr, /etc or C:\Windows) are protected.
+// It is meant to be passed to New().
+func ProtectedDirs(dirs ...string) Option {
+	return func(c *config) {
+		c.ProtectedDirs = append(c.ProtectedDirs, dirs...)
+	}
+}
+
+// ForceRoot is an Option that allows to unpack inside of the protected directories, see ProtectedDirs.
+// It is meant to be passed to New().
+var ForceRoot Option = func(c *config) {
+	c.ProtectedDirs = nil
+}
+
+// LongPathPolicy decides what happens to archive entries whose paths would be too long for the operating system.
+type LongPathPolicy = lib.LongPathPolicy
+
+const (
+	// LongPathsIgnore writes the entries anyway, so the operating system may fail. This is the default.
+	LongPathsIgnore = lib.LongPathsIgnore
+
+	// LongPathsShorten shortens the names of the entries with a hash suffix and leaves out the deepest
+	// directories, if needed. Every shortened entry is logged.
+	LongPathsShorten = lib.LongPathsShorten
+
+	// LongPathsSkip does not write the entries. Every skipped entry is logged.
+	LongPathsSkip = lib.LongPathsSkip
+
+	// LongPathsFail aborts the unpacking with an error that names the entry.
+	LongPathsFail = lib.LongPathsFail
+)
+
+// LongPaths returns an Option that sets the policy for archive entries whose destination paths would exceed the
+// limits of the operating system (e.g. 260 characters on Windows or 255 bytes for a name), instead of letting the
+// extraction fail halfway through with a confusing error. It is applied by the native backend (see Native).
+// It is meant to be passed to New().
+func LongPaths(policy LongPathPolicy) Option {
+	return func(c *config) {
+		c.LongPaths = policy
+	}
+}
+
+// MaxExtractedSize returns an Option that aborts the extraction of an archive when more than
+// the given number of bytes have been extracted from it. Everything extracted so far is removed then.
+// This protects against decompression bombs. External commands are watched while they are running
+// and killed when the limit is exceeded.
+// It is meant to be passed to New().
+func MaxExtractedSize(bytes int64) Option {
+	return func(c *config) {
+		c.MaxExtractedSize = bytes
+	}
+}
+
+// MaxFileCount returns an Option that aborts the extraction of an archive when more than the
+// given number of files and directories have been extracted from it (see MaxExtractedSize).
+// It is meant to be passed to New().
+func MaxFileCount(files int64) Option {
+	return func(c *config) {
+		c.MaxFileCount = files
+	}
+}
+
+// MaxCompressionRatio returns an Option that aborts the extraction of an archive when the ratio of the
+// extracted bytes to the size of the archive file exceeds the given ratio (see MaxExtractedSize).
+// It is meant to be passed to New().
+func MaxCompressionRatio(ratio float64) Option {
+	return func(c *config) {
+		c.MaxCompressionRatio = ratio
+	}
+}
+
+// Timeout returns an Option that aborts the extraction of an archive that takes longer than d, e.g. because a
+// tool hangs on a corrupt file. The command is killed (with its child processes) and what has been extracted
+// so far is removed. The error is a TimeoutError with the code CodeTimeout (see ErrorCode).
+// It is meant to be passed to New().
+func Timeout(d time.Duration) Option {
+	return func(c *config) {
+		c.Timeout = d
+	}
+}
+
+// Deadline returns an Option that aborts the extraction that runs at the time t with a DeadlineError (see
+// Timeout). Batches (e.g. UnpackAllFiles) don't start further archives after t, so that d in
+// Deadline(time.Now().Add(d)) limits the duration of a whole run.
+// It is meant to be passed to New().
+func Deadline(t time.Time) Option {
+	return func(c *config) {
+		c.Deadline = t
+	}
+}
+
+// DecoderMemoryLimit returns an Option that limits the memory that decoders may use for their windows and
+// dictionaries to the given number of bytes, so that hostile archives that request huge windows can't consume
+// all memory of a service. Exceeding the limit makes the unpacking fail with the code CodeLimitExceeded
+// (see ErrorCode) instead of allocating. The limit is passed to xz (also when called by tar), the native
+// backend applies it to archives that it would have to buffer in memory. Note that zstd refuses windows larger
+// than 128 MiB by default anyway.
+// It is meant to be passed to New().
+func DecoderMemoryLimit(bytes int64) Option {
+	return func(c *config) {
+		c.DecoderMemoryLimit = bytes
+	}
+}
+
+// VerifyChecksum returns an Option that compares the checksum of an archive with the expected one before it is
+// tested, moved or extracted. If sumsFile is empty, the expected checksum is taken from a file beside the archive,
+// if there is one: foo.tgz.sha256, foo.tgz.md5 (just the checksum or the output of sha256sum and md5sum) or
+// SHA256SUMS (a line for foo.tgz). Otherwise sumsFile must have the checksum (MD5, SHA-1, SHA-256 or SHA-512,
+// as told by its length). A mismatch fails with the code CodeChecksumMismatch (see ErrorCode).
+// It is meant to be passed to New().
+func VerifyChecksum(sumsFile string) Option {
+	return func(c *config) {
+		c.Options.VerifyChecksum = true
+		c.ChecksumFile = sumsFile
+	}
+}
+
+// SignaturePolicy decides whether the detached OpenPGP signatures of archives are verified.
+type SignaturePolicy = lib.SignaturePolicy
+
+const (
+	// SignaturesIgnore does not verify signatures. This is the default.
+	SignaturesIgnore = lib.SignaturesIgnore
+
+	// SignaturesVerify verifies the signature beside an archive, if there is one.
+	SignaturesVerify = lib.SignaturesVerify
+
+	// SignaturesRequire verifies the signature beside an archive and refuses unsigned archives (strict mode).
+	SignaturesRequire = lib.SignaturesRequire
+)
+
+// VerifySignature returns an Option that verifies the detached signature beside an archive (foo.tgz.asc or
+// foo.tgz.sig) with gpg before it is tested, moved or extracted, as given by policy. The public keys are taken from
+// the keyring file or, if it is empty, from the default keyring of gpg. Bad signatures (and, with SignaturesRequire,
+// missing ones) fail with the code CodeBadSignature (see ErrorCode).
+// It is meant to be passed to New().
+func VerifySignature(policy SignaturePolicy, keyring string) Option {
+	return func(c *config) {
+		c.Signatures = policy
+		c.Keyring = keyring
+	}
+}
+
+// PackModTime returns an Option that uses the given time as modification time of all entries written by
+// Pack and PackFS, so that packing the same files always results in the same archive.
+// It is meant to be passed to New().
+func PackModTime(t time.Time) Option {
+	return func(c *config) {
+		c.ModTime = t
+	}
+}
+
+// Reproducible is an Option that makes the extraction reproducible, e.g. for build systems that hash
+// extracted trees: All extracted files and directories get the newest modification time that is found inside
+// the archive and the access time of the archive is not changed, where possible (O_NOATIME for the native
+// backend, restoring the access time after external commands ran).
+// Archives are processed in lexical order by UnpackAllFiles and UnpackFilesMatching.
+// It is meant to be passed to New().
+var Reproducible Option = func(c *config) {
+	c.Reproducible = true
+}
+
+// ReproducibleAt returns an Option that is like Reproducible but uses t as modification time of
+// all extracted files and directories. t is also used by Pack and PackFS (see PackModTime).
+// It is meant to be passed to New().
+func ReproducibleAt(t time.Time) Option {
+	return func(c *config) {
+		c.Reproducible = true
+		c.ModTime = t
+	}
+}
+
+// DirHash returns the hash of the content of dir, e.g. of an unpacked directory. It is compatible with
+// golang.org/x/mod/sumdb/dirhash, i.e. dirhash.HashDir(dir, prefix, dirhash.Hash1), so consumers can
+// verify that a tree matches a known-good archive without keeping the archive.
+// The names of the files are relative to dir and prefixed by prefix (which may be empty).
+func DirHash(dir string, prefix string) (string, error) {
+	return lib.DirHash(dir, prefix)
+}
+
+// Quick extracts the archive file into a subdirectory of dir which is named after file (- its extension)
+// and leaves file where it is. It is meant for build tools and go:generate programs that just need an archive
+// extracted (see also the -q flag of the unpack command).
+// Quick does not log anything, prefers the native backend, keeps only relative symbolic links
+// pointing inside the created directory and removes __MACOSX directories. Use New for anything else.
+func Quick(file string, dir string) (err error) {
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return
+	}
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	opts := lib.Options{
+		PreferNative: true,
+		Symlinks:     lib.SymlinksRelativeOnly,
+		RemoveDirs:   []string{"__MACOSX"},
+		LogLevel:     -1,
+	}
+	return lib.UnpackCopy(filepath.Base(file), filepath.Dir(file), dir, &opts)
+}
+
+// Cache returns an Option that caches the content of extracted archives inside dir, keyed by the hash
+// of the name and content of the archive. If the same archive is unpacked again, its content is
+// hardlinked (or copied, if hardlinking is not possible) from the cache instead of running the
+// unpacker again. Since hardlinked files share their content with the cache, modifying them in place
+// modifies the cache as well.
+// It is meant to be passed to New().
+func Cache(dir string) Option {
+	return func(c *config) {
+		c.CacheDir = dir
+	}
+}
+
+// Chain returns an Option that continues unpacking in place, if the content of an archive is just
+// another archive, e.g. a .gz file that contains a .tar file. This is repeated up to depth times.
+// The intermediate archives are removed.
+// It is meant to be passed to New().
+func Chain(depth int) Option {
+	return func(c *config) {
+		c.ChainDepth = depth
+	}
+}
+
+// NestedDepth returns an Option that, after an archive has been extracted, unpacks the archives of known
+// extensions inside of the result into subdirectories next to them, like UnpackFile would do (e.g. for vendor drops
+// that ship zips inside of zips). This is repeated for the archives inside of them, down to depth levels.
+// In contrast to Chain, nested archives may be anywhere inside the unpacked directory.
+// It is meant to be passed to New().
+func NestedDepth(depth int) Option {
+	return func(c *config) {
+		c.NestedDepth = depth
+	}
+}
+
+// Job describes the unpacking of an archive file, see OnDone.
+type Job = lib.Job
+
+// OnDone returns an Option that calls fn after each archive file has been unpacked by UnpackFile, UnpackURL,
+// UnpackFS or UnpackReader or failed to unpack, e.g. to find out the created directory and the number of extracted
+// files. Several callbacks may be registered.
+// It is meant to be passed to New().
+func OnDone(fn func(Job)) Option {
+	return func(c *config) {
+		c.addDone(fn)
+	}
+}
+
+// Progress is the state of the extraction of an archive, see OnProgress.
+type Progress = lib.Progress
+
+// OnProgress returns an Option that calls fn while an archive is extracted: the native backend calls it for every
+// entry (and at least every 100ms while bytes are written), commands whenever the extracted files are measured.
+// The totals are known for zips and, with PreScan, also for tars.
+// It is meant to be passed to New().
+func OnProgress(fn func(Progress)) Option {
+	return func(c *config) {
+		c.Progress = fn
+	}
+}
+
+// PreScan is an Option that reads the headers of the entries of tars (which have no central directory) before they
+// are extracted, so that the totals of the Progress are known and percentages are possible. The totals are cached
+// for the process, also by Inspect, so repeated runs don't scan again.
+// It is meant to be passed to New().
+var PreScan Option = func(c *config) {
+	c.PreScan = true
+}
+
+func (c *config) addDone(fn func(lib.Job)) {
+	prev := c.Done
+	if prev == nil {
+		c.Done = fn
+		return
+	}
+	c.Done = func(j lib.Job) {
+		prev(j)
+		fn(j)
+	}
+}
+
 // RemoveArchive is an Option that removes the archive file after successful unpacking.
 // It is meant to be passed to New().
 var RemoveArchive Option = func(c *config) {
-	c.removeArchive = true
+	c.Remove = true
+}
+
+// KeepArchiveInPlace is an Option that leaves the archive file where it is instead of moving it into the
+// unpacked directory, e.g. for download managers and torrent clients that still need it. Directories that are
+// unpacked again and again (see Daemon) should be combined with OverwritePolicy(IfExistsSkip) then.
+// It is meant to be passed to New().
+var KeepArchiveInPlace Option = func(c *config) {
+	c.KeepInPlace = true
+}
+
+// DirNameTemplate returns an Option that names the unpacked directories after the template tmpl instead of the
+// archive (- its extension), e.g. "{name}-{date}" or "{name}-{sha1:8}" for many versions of the same archive name.
+// The placeholders are {name}, {ext}, {date}, {time}, {mtime}, {sha1} and {sha256}, a number after a colon keeps only
+// that many characters (see CheckDirTemplate). An invalid template makes the unpacking fail. UnpackReader is
+// given its directory, so the template does not apply there.
+// It is meant to be passed to New().
+func DirNameTemplate(tmpl string) Option {
+	return func(c *config) {
+		c.DirTemplate = tmpl
+	}
+}
+
+// CheckDirTemplate returns an error, if tmpl is not a valid template for DirNameTemplate.
+func CheckDirTemplate(tmpl string) error {
+	return lib.CheckDirTemplate(tmpl)
+}
+
+// ExtractHere is an Option that extracts the archive directly into the directory like tar -xf, instead of
+// creating a directory named after the archive. The archive file stays where it is, unless RemoveArchive is passed,
+// nothing is flattened and entries that exist already are handled following OverwritePolicy.
+// It is meant to be passed to New().
+var ExtractHere Option = func(c *config) {
+	c.ExtractHere = true
+}
+
+// RestoreOnError is an Option that moves the archive file back to its directory and removes the
+// unpacked directory, if the unpacking by UnpackFile fails, so that it can simply be retried.
+// It is meant to be passed to New().
+var RestoreOnError Option = func(c *config) {
+	c.RestoreOnError = true
+}
+
+// NoFlatten is an Option that keeps the exact layout of the archive: a single top level directory
+// stays inside the unpacked directory instead of being moved one folder up.
+// It is meant to be passed to New().
+var NoFlatten Option = func(c *config) {
+	c.NoFlatten = true
+}
+
+// FlattenDepth returns an Option that flattens the unpacked directory up to depth times, so that chains of
+// single directories like release/dist/v1 are collapsed. 0 collapses the whole chain. By default one level is flattened.
+// It is meant to be passed to New().
+func FlattenDepth(depth int) Option {
+	return func(c *config) {
+		if depth <= 0 {
+			depth = -1
+		}
+		c.FlattenDepth = depth
+	}
+}
+
+// StripComponents returns an Option that removes the first n path elements from the names of the unpacked
+// entries, like tar --strip-components, e.g. 1 for archives of the form project-1.2/src/...
+// Entries with no more elements are not unpacked. Unpacker commands that use tar get the flag, the entries
+// unpacked by other commands are moved up afterwards. Nested archives are not stripped.
+// It is meant to be passed to New().
+func StripComponents(n int) Option {
+	return func(c *config) {
+		c.StripComponents = n
+	}
+}
+
+// Include returns an Option that unpacks only the entries that match one of the globs (see path.Match) with their
+// slash separated path or their base name, or that are inside a matching directory, e.g. Include("*.sql").
+// It may be passed more than once. The native backend skips the other entries, tar commands get the Exclude globs
+// as --exclude and the entries that other commands unpacked are removed afterwards. Malformed globs
+// (see CheckGlobs) make the unpacking fail.
+// It is meant to be passed to New().
+func Include(globs ...string) Option {
+	return func(c *config) {
+		c.Include = append(c.Include, globs...)
+	}
+}
+
+// Exclude returns an Option that leaves out the entries that match one of the globs like Include,
+// e.g. Exclude("*.log", "node_modules"). Exclude wins over Include.
+// It is meant to be passed to New().
+func Exclude(globs ...string) Option {
+	return func(c *config) {
+		c.Exclude = append(c.Exclude, globs...)
+	}
+}
+
+// CheckGlobs returns an error, if one of the globs is not valid for Include or Exclude.
+func CheckGlobs(globs ...string) error {
+	return lib.CheckGlobs(globs)
+}
+
+// ManifestFile is the name of the manifest that WriteManifest writes into the created directory.
+const ManifestFile = lib.ManifestFile
+
+// WriteManifest is an Option that writes the ManifestFile into the created directory after the extraction. It lists
+// every extracted file with its SHA-256 and size, one per line like "<sha256>  <size>  <path>", sorted by the
+// slash separated paths, so that the extraction can be verified later. It is not written for single files
+// (see SingleFile).
+// It is meant to be passed to New().
+var WriteManifest Option = func(c *config) {
+	c.Manifest = true
+}
+
+// SingleFile is an Option that moves the file that a decompressor produced (e.g. foo from foo.gz) next to
+// the archive instead of keeping it inside the unpacked directory foo.
+// It is meant to be passed to New().
+var SingleFile Option = func(c *config) {
+	c.SingleFile = true
+}
+
+// KeepDownload is an Option that keeps archives that have been downloaded by UnpackFile inside the
+// unpacked directory. By default they are removed after successful unpacking.
+// It is meant to be passed to New().
+var KeepDownload Option = func(c *config) {
+	c.keepDownload = true
 }
 
 // RemoveDirectories returns an Option that removes typical directories to be removed within extracted files, like __MACOSX, .git and .svn.
 // It is meant to be passed to New().
 func RemoveDirectories(dirs ...string) Option {
 	return func(c *config) {
-		c.rmDirs = dirs
+		c.RemoveDirs = dirs
 	}
 }
 
 // LogVerbose is an Option that enables verbose logging. This also includes error logging and info logging.
 // It is meant to be passed to New().
 var LogVerbose Option = func(c *config) {
-	c.logLevel = 2
+	c.LogLevel = 2
 }
 
 // LogErrors is an Option that enables error logging.
 // It is meant to be passed to New().
 var LogErrors Option = func(c *config) {
-	c.logLevel = 0
+	c.LogLevel = 0
 }
 
 // LogInfos is an Option that enables info logging. This also includes error logging.
 // It is meant to be passed to New().
 var LogInfos Option = func(c *config) {
-	c.logLevel = 1
+	c.LogLevel = 1
+}
+
+// Logger receives the log messages of an unpacker, see WithLogger.
+type Logger = lib.Logger
+
+// WithLogger returns an Option that sends the log messages of the unpacker to l instead of writing them to stdout,
+// e.g. to route them into log/slog, zap or logrus. The logging options (LogErrors, LogInfos and LogVerbose) still
+// decide which messages are sent: Debug is called for verbose messages. The output of the commands is sent line
+// by line, standard error to Error and (only with LogVerbose) standard output to Debug.
+// It is meant to be passed to New().
+func WithLogger(l Logger) Option {
+	return func(c *config) {
+		c.Logger = l
+	}
+}
+
+// LogTo returns an Option that writes the error, info and verbose messages to the given writers instead of stdout,
+// e.g. the errors to os.Stderr, so that they don't mix with piped output. A nil writer drops the messages of
+// its level. The standard error of the commands goes to the writer of the errors, their standard output (only
+// with LogVerbose) to the writer of the verbose messages. It replaces a Logger of WithLogger.
+// It is meant to be passed to New().
+func LogTo(errors io.Writer, infos io.Writer, verbose io.Writer) Option {
+	return func(c *config) {
+		c.Logger = lib.NewWriterLogger(errors, infos, verbose)
+	}
+}
+
+// SyslogLogger is a Logger that sends the messages to the local syslog daemon, see NewSyslogLogger.
+type SyslogLogger = lib.SyslogLogger
+
+// NewSyslogLogger connects to the local syslog daemon and returns a Logger (see WithLogger) that sends the
+// messages with the priorities debug, info and err of the facility user, tagged with tag (the name of the program,
+// if it is empty), e.g. for runs from cron. Syslog is not supported on windows, js/wasm and wasip1.
+func NewSyslogLogger(tag string) (*SyslogLogger, error) {
+	return lib.NewSyslogLogger(tag)
+}
+
+// JournalLogger is a Logger that sends the messages to systemd-journald, see NewJournalLogger.
+type JournalLogger = lib.JournalLogger
+
+// NewJournalLogger connects to the socket of systemd-journald and returns a Logger (see WithLogger) that sends the
+// messages with the priorities debug, info and err and the given SYSLOG_IDENTIFIER, e.g. for runs from systemd
+// timers. The messages can be read with journalctl -t identifier.
+func NewJournalLogger(identifier string) (*JournalLogger, error) {
+	return lib.NewJournalLogger(identifier)
 }
 
 // Option is a configuration option that is meant to be passed to New().
@@ -70,12 +988,25 @@ type Option func(*config)
 // By default, logging is disabled. To enable it, pass one of the logging options as parameter.
 // New accepts options of type Option to enabled configuration.
 func New(opts ...Option) interface {
+	TestArchive(string) error
 	UnpackFile(string) error
+	UnpackFileResult(string) (Result, error)
+	UnpackURL(url string, dir string) error
+	UnpackFS(fsys fs.FS, name string, dir string) error
+	UnpackBytes(data []byte, name string, dir string) error
+	UnpackReader(r io.Reader, format string, destDir string) error
+	Pack(dir string, file string) error
+	PackFS(fsys fs.FS, file string) error
 	UnpackAllFiles(string) map[string]error
 	UnpackFilesMatching(dir string, pattern string) map[string]error
+	UnpackFilesGlob(dir string, pattern string) map[string]error
+	ExtractFound(entries []CatalogEntry, dir string) map[string]error
+	ExtractEntries(file string, paths []string, dest string) error
+	ReleaseResources()
 } {
 	c := &config{}
-	c.logLevel = -1
+	c.LogLevel = -1
+	c.ProtectedDirs = lib.ProtectedDirs()
 
 	for _, opt := range opts {
 		opt(c)
@@ -85,9 +1016,26 @@ func New(opts ...Option) interface {
 }
 
 type config struct {
-	removeArchive bool
-	rmDirs        []string
-	logLevel      int
+	lib.Options
+	testArchive  bool
+	keepDownload bool
+	errorPolicy  ErrorPolicy
+}
+
+// TestArchive checks the integrity of the given file with the tester command that has been registered
+// for its extension. By default that includes: ".tgz",".tar",".zip",".rar",".7z",".gz",".tar.gz",".tar.bz2",".tar.xz",
+// ".txz",".tbz2",".tbz",".tar.zst",".tzst",".tar.lz4",".tar.lzma",".tar.Z",".xz",".bz2",".zst",".lz4",".lzma",".Z"
+// The file is neither moved nor extracted.
+func (c *config) TestArchive(file string) (err error) {
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return
+	}
+	err = lib.VerifyArchive(file, &c.Options)
+	if err != nil {
+		return
+	}
+	return lib.TestFile(filepath.Base(file), filepath.Dir(file), &c.Options)
 }
 
 // UnpackFile unpacks the given file into a subdirectory which is named after the file (- its extension)
@@ -99,21 +1047,230 @@ type config struct {
 // the content of this folder will be moved one folder up.
 // If RemoveArchive was set, file is removed after successful unpacking.
 // Any directories set via RemoveDirectories will be removed inside the unpacked directory.
+// If TestBeforeUnpack was set, the integrity of file is tested before anything else happens.
+// If file is a volume of a multi-part archive (foo.part1.rar, foo.rar + foo.r00, foo.7z.001 or foo.zip + foo.z01),
+// all volumes are moved (and removed) together and extracted from the first volume into the subdirectory foo.
+// If file is an URL with a registered scheme (see RegisterSource), e.g. "https://example.com/release.tar.gz"
+// or "s3://bucket/key.tgz", the archive is downloaded first and unpacked into a subdirectory of the
+// current working directory (see KeepDownload).
 func (c *config) UnpackFile(file string) (err error) {
+	if lib.IsURL(file) {
+		return c.unpackURL(file)
+	}
 	file, err = filepath.Abs(file)
 	if err != nil {
 		return
 	}
-	return lib.UnpackFile(filepath.Base(file), filepath.Dir(file), c.removeArchive, c.rmDirs, c.logLevel)
+	if c.testArchive {
+		err = lib.TestFile(filepath.Base(file), filepath.Dir(file), &c.Options)
+		if err != nil {
+			return
+		}
+	}
+	return lib.UnpackFile(filepath.Base(file), filepath.Dir(file), &c.Options)
+}
+
+// Result is the result of UnpackFileResult.
+type Result struct {
+	// Dir is the absolute path of the created directory (or the file, see SingleFile)
+	Dir string
+
+	// Files and Bytes are the number and the total size of the extracted regular files
+	Files int64
+	Bytes int64
+
+	// Flattened is true, if the content of a single directory inside Dir has been moved up
+	Flattened bool
+
+	// Duration is the time that the unpacking took
+	Duration time.Duration
+
+	// Command is the command that extracted the archive, it is empty if the native backend extracted it
+	Command string
+}
+
+// UnpackFileResult is like UnpackFile, but also returns where the content ended up and how it got there.
+// The Result is empty, if the archive has not been unpacked, e.g. because it failed before its directory
+// was created or was skipped (see IfExistsSkip).
+func (c *config) UnpackFileResult(file string) (res Result, err error) {
+	u := *c
+	u.addDone(func(j lib.Job) {
+		res = Result{
+			Dir:       j.Dir,
+			Files:     j.Files,
+			Bytes:     j.Bytes,
+			Flattened: j.Flattened,
+			Duration:  j.Duration,
+			Command:   j.Command,
+		}
+	})
+	err = u.UnpackFile(file)
+	return
+}
+
+func (c *config) unpackURL(url string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return c.UnpackURL(url, wd)
+}
+
+// UnpackURL downloads the archive at url (see RegisterSource) and unpacks it into a subdirectory of dir which is
+// named after the archive (- its extension). The downloaded archive is removed afterwards, unless KeepDownload is set.
+func (c *config) UnpackURL(url string, dir string) (err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+
+	// the download belongs to the span of the archive
+	traced, span := lib.Trace(&c.Options, url)
+	defer func() {
+		span.End(err)
+	}()
+
+	file, err := lib.Download(url, traced)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(filepath.Dir(file))
+
+	if c.testArchive {
+		err = lib.TestFile(filepath.Base(file), filepath.Dir(file), traced)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := *traced
+	opts.Remove = !c.keepDownload
+	// the temporary directory is removed
+	opts.KeepInPlace = false
+
+	if done := opts.Done; done != nil {
+		opts.Done = func(j lib.Job) {
+			j.Archive = url
+			done(j)
+		}
+	}
+	if events := opts.Events; events != nil {
+		opts.Events = func(e lib.Event) {
+			e.Archive = url
+			if e.Job != nil {
+				e.Job.Archive = url
+			}
+			events(e)
+		}
+	}
+	return lib.UnpackFileFrom(filepath.Base(file), filepath.Dir(file), dir, &opts)
+}
+
+// UnpackFS extracts the archive name that is read from fsys with the native backend into a subdirectory
+// of dir which is named after the archive (- its extension).
+// name must be a valid path for fsys (see io/fs.ValidPath).
+// Since the archive is not part of the local filesystem, it is neither moved nor removed.
+// Any directories set via RemoveDirectories will be removed inside the unpacked directory and the
+// unpacked directory is flattened as described for UnpackFile.
+func (c *config) UnpackFS(fsys fs.FS, name string, dir string) (err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	return lib.UnpackFS(fsys, name, dir, &c.Options)
+}
+
+// ReleaseResources drops the buffers and decompressors that the native backend keeps for reuse, the cached
+// totals of scanned archives and the directories that have been created more than 10 minutes ago from the ones
+// that batches skip as own output, and returns the freed memory to the operating system. The pools are shared by
+// all unpackers of the process. Long running processes should call it when they become idle; the Daemon does it
+// after each scan and the Watcher after each archive.
+func (c *config) ReleaseResources() {
+	lib.ReleaseResources()
+}
+
+// ExtractEntries extracts only the entries with the given slash separated paths inside the archive file (and everything
+// inside of them, if they are directories) into dest, e.g. ExtractEntries("backup.zip", []string{"db/dump.sql"}, "."),
+// so that a single file of a huge archive does not require to unpack all of it. In contrast to UnpackFile, dest is
+// used as it is (it is created, if necessary), the paths are kept and the archive stays where it is.
+// Archives with a native unpacker are read just as far as needed, others are extracted by the registered command
+// into a temporary directory inside dest first. An error that wraps fs.ErrNotExist is returned, if one of
+// the paths is not part of the archive.
+func (c *config) ExtractEntries(file string, paths []string, dest string) (err error) {
+	file, err = filepath.Abs(file)
+	if err != nil {
+		return
+	}
+	dest, err = filepath.Abs(dest)
+	if err != nil {
+		return
+	}
+	if c.testArchive {
+		err = lib.TestFile(filepath.Base(file), filepath.Dir(file), &c.Options)
+		if err != nil {
+			return
+		}
+	}
+	return lib.ExtractEntries(file, paths, dest, &c.Options)
+}
+
+// UnpackBytes extracts the archive data into a subdirectory of dir which is named after name (- its extension).
+// It is meant for small archives that are already held in memory, e.g. from an HTTP upload.
+// Only the base of name is used and its extension selects the unpacker. If there is a native unpacker for
+// the extension (".tgz",".tar.gz",".tar",".zip",".gz",".bz2",".tbz2",".tbz",".tar.bz2"), data is extracted without writing it to disk. Otherwise data is written
+// to the created subdirectory, extracted by the registered command and removed afterwards.
+// Any directories set via RemoveDirectories will be removed inside the unpacked directory and the
+// unpacked directory is flattened as described for UnpackFile.
+func (c *config) UnpackBytes(data []byte, name string, dir string) (err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return
+	}
+	return lib.UnpackBytes(data, name, dir, &c.Options)
+}
+
+// UnpackReader extracts the archive that is read from r, e.g. os.Stdin, into the directory destDir, which is
+// created (with a suffix like -1, if it already exists). format is the extension of the archive without the
+// leading dot, e.g. "tgz", "tar.gz" or "zip". If there is a native unpacker for the format, the archive is
+// extracted while it is read. Otherwise it is written to destDir, extracted by the registered command and
+// removed afterwards.
+// Any directories set via RemoveDirectories will be removed inside destDir and destDir is flattened as
+// described for UnpackFile.
+func (c *config) UnpackReader(r io.Reader, format string, destDir string) (err error) {
+	destDir, err = filepath.Abs(destDir)
+	if err != nil {
+		return
+	}
+	return lib.UnpackReader(r, format, destDir, &c.Options)
+}
+
+// Pack writes all files and directories inside dir into the archive file. The extension of file selects
+// the format: ".tar", ".tgz" (".tar.gz") or ".zip". The archive is written natively, i.e. without running a command.
+// See PackFS.
+func (c *config) Pack(dir string, file string) error {
+	return c.PackFS(os.DirFS(dir), file)
+}
+
+// PackFS writes all files and directories of fsys into the archive file, so that archives may be built
+// from embedded or synthesized filesystems. The extension of file selects the format: ".tar", ".tgz" (".tar.gz") or ".zip".
+// The entries are written in lexical order. If PackModTime was set, all entries get that modification time,
+// otherwise their own. Symbolic links and other irregular files are skipped.
+func (c *config) PackFS(fsys fs.FS, file string) error {
+	return lib.PackFS(fsys, file, c.ModTime, &c.Options)
 }
 
 // UnpackAllFiles is like UnpackFile, but acting on all files with an extension for which a unpacker command
-// has been registered. By default that includes: ".tgz",".tar",".zip",".rar",".7z",".gz"
+// has been registered. By default that includes: ".tgz",".tar",".zip",".rar",".7z",".gz",".tar.gz",".tar.bz2",".tar.xz",
+// ".txz",".tbz2",".tbz",".tar.zst",".tzst",".tar.lz4",".tar.lzma",".tar.Z",".xz",".bz2",".zst",".lz4",".lzma",".Z"
 // Make sure the corresponding command is available since otherwise in the middle of the processing there will
 // be a problem when the command is executed. If so that function returns at a state when the archive file has
 // been moved to the newly created folder (see documentation of UnpackFile).
+// Files that have been written by unpack itself (named .unpack*) and files that vanished while
+// iterating over dir (e.g. moved volumes of a multi-part archive) are skipped, so it is safe to run it again.
 func (c *config) UnpackAllFiles(dir string) (errors map[string]error) {
-	return c.unpackFilesInDir(dir, fileHasUnpacker)
+	return c.unpackFilesInDir(dir, func(fname string) bool {
+		return isArchive(filepath.Join(dir, fname))
+	})
 }
 
 // UnpackFilesMatching is like UnpackAllFiles but only affects the files that are matching the given pattern.
@@ -134,27 +1291,84 @@ func (c *config) UnpackFilesMatching(dir string, pattern string) (errors map[str
 	return c.unpackFilesInDir(dir, cb)
 }
 
+// UnpackFilesGlob is like UnpackFilesMatching, but selects the files by the shell-style pattern (see filepath.Match),
+// e.g. "*.zip", which is relative to dir and may also match files inside subdirectories, e.g. "*/*.tgz". The matching
+// regular files are unpacked in lexical order, an invalid pattern returns a GlobError.
+func (c *config) UnpackFilesGlob(dir string, pattern string) (errors map[string]error) {
+	glob := pattern
+	if !filepath.IsAbs(glob) {
+		glob = filepath.Join(dir, glob)
+	}
+
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return map[string]error{
+			pattern: lib.GlobError(pattern),
+		}
+	}
+
+	var files []string
+	for _, file := range matches {
+		finfo, err := os.Stat(file)
+		if err != nil || !finfo.Mode().IsRegular() || lib.IsOwn(file) || lib.IsFollowingVolume(filepath.Dir(file), filepath.Base(file)) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return c.unpackFiles(files)
+}
+
+func exists(file string) bool {
+	_, err := os.Lstat(file)
+	return err == nil
+}
+
 func fileHasUnpacker(file string) bool {
-	return lib.HasUnpacker(filepath.Ext(file))
+	return lib.HasUnpacker(lib.Ext(file)) || lib.IsVolumeName(file)
+}
+
+// isArchive reports whether the file at path has an unpacker (see fileHasUnpacker) or is detected as an archive,
+// see RegisterDetector
+func isArchive(path string) bool {
+	return fileHasUnpacker(filepath.Base(path)) || lib.Detect(path) != ""
 }
 
 // callback is a function that gets a filename and returns true if the file should be unpacked
 func (c *config) unpackFilesInDir(dir string, callback func(fname string) bool) (errors map[string]error) {
 	errs := map[string]error{}
 
-	finfos, err := ioutil.ReadDir(dir)
+	files, err := archivesInDir(dir, callback)
 
 	if err != nil {
 		errs[dir] = err
 		return errs
 	}
 
-	for _, finfo := range finfos {
-		if !finfo.IsDir() && callback(finfo.Name()) {
-			fErr := c.UnpackFile(filepath.Join(dir, finfo.Name()))
+	return c.unpackFiles(files)
+}
+
+// unpackFiles unpacks the files one after another, as far as the error policy allows it
+func (c *config) unpackFiles(files []string) (errors map[string]error) {
+	errs := map[string]error{}
 
-			if fErr != nil {
-				errs[filepath.Join(dir, finfo.Name())] = fErr
+	for _, file := range files {
+		// skip the files that have been moved in the meantime, e.g. the volumes of a multi-part archive
+		if !exists(file) {
+			continue
+		}
+
+		if c.deadlinePassed() {
+			errs[file] = &lib.DeadlineError{Deadline: c.Deadline}
+			break
+		}
+
+		fErr := c.UnpackFile(file)
+
+		if fErr != nil {
+			errs[file] = fErr
+
+			if c.errorPolicy == FailFast {
+				break
 			}
 		}
 	}
@@ -165,3 +1379,32 @@ func (c *config) unpackFilesInDir(dir string, callback func(fname string) bool)
 
 	return nil
 }
+
+// deadlinePassed reports whether the Deadline has passed, see Deadline
+func (c *config) deadlinePassed() bool {
+	return !c.Deadline.IsZero() && time.Now().After(c.Deadline)
+}
+
+// archivesInDir returns the files inside dir that should be unpacked, i.e. that are accepted by callback
+// and are neither the output of this process nor following volumes of a multi-part archive
+func archivesInDir(dir string, callback func(fname string) bool) (files []string, err error) {
+	finfos, err := ioutil.ReadDir(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, finfo := range finfos {
+		file := filepath.Join(dir, finfo.Name())
+
+		if lib.IsOwn(file) {
+			continue
+		}
+
+		if !finfo.IsDir() && callback(finfo.Name()) && !lib.IsFollowingVolume(dir, finfo.Name()) {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
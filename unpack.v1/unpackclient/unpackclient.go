@@ -0,0 +1,137 @@
+// Package unpackclient is a client for the HTTP API of "unpack serve" (see package unpackhttp), so that
+// Go services can delegate the unpacking to a central unpack service.
+//
+// The service handles each request synchronously: the methods return when the archive has been unpacked.
+// Failed requests return an *unpackhttp.Problem as error, whose Code is stable.
+package unpackclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/metakeule/unpack/unpack.v1/unpackhttp"
+)
+
+// Client sends requests to an unpack service
+type Client struct {
+	// BaseURL is the URL of the service, e.g. "http://localhost:8080"
+	BaseURL string
+
+	// Token is sent as bearer token, if it is not empty (see unpackhttp.Policy)
+	Token string
+
+	// Field is the name of the form field for uploads, it defaults to "file"
+	Field string
+
+	// HTTPClient is used for the requests, it defaults to http.DefaultClient
+	HTTPClient *http.Client
+}
+
+// New returns a Client for the service at baseURL
+func New(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), Field: "file"}
+}
+
+// Unpack sends the TriggerRequest to the service, i.e. the service unpacks an archive that is on the
+// server (req.Path) or at an URL (req.URL).
+func (c *Client) Unpack(ctx context.Context, req unpackhttp.TriggerRequest) (*unpackhttp.TriggerResult, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var res unpackhttp.TriggerResult
+	err = c.do(ctx, "/unpack", "application/json", bytes.NewReader(body), &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UnpackPath lets the service unpack the archive at path, which is relative to its first root
+func (c *Client) UnpackPath(ctx context.Context, path string, opts unpackhttp.TriggerOptions) (*unpackhttp.TriggerResult, error) {
+	return c.Unpack(ctx, unpackhttp.TriggerRequest{Path: path, Options: opts})
+}
+
+// UnpackURL lets the service download the archive at url and unpack it inside dir (which is relative to its first root)
+func (c *Client) UnpackURL(ctx context.Context, url string, dir string, opts unpackhttp.TriggerOptions) (*unpackhttp.TriggerResult, error) {
+	return c.Unpack(ctx, unpackhttp.TriggerRequest{URL: url, Dir: dir, Options: opts})
+}
+
+// Upload uploads the archive that is read from r under the given name (its extension selects the unpacker)
+// and returns the Result with the unpacked entries. The archive is streamed, it is not held in memory.
+func (c *Client) Upload(ctx context.Context, name string, r io.Reader) (*unpackhttp.Result, error) {
+	field := c.Field
+	if field == "" {
+		field = "file"
+	}
+
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+
+	go func() {
+		part, err := mw.CreateFormFile(field, name)
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	var res unpackhttp.Result
+	err := c.do(ctx, "/upload", mw.FormDataContentType(), pr, &res)
+	pr.Close()
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// do posts body to the path of the service and decodes the response into res
+func (c *Client) do(ctx context.Context, path string, contentType string, body io.Reader, res interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Accept", "application/json, application/problem+json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == "application/problem+json" {
+		var p unpackhttp.Problem
+		err = json.NewDecoder(resp.Body).Decode(&p)
+		if err != nil {
+			return fmt.Errorf("%s: invalid problem: %v", resp.Status, err)
+		}
+		return &p
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
@@ -0,0 +1,233 @@
+// Package unpackgrpc provides a gRPC service that unpacks archives on the server and streams the progress,
+// so that other Go services can drive unpack remotely with the types of this package.
+//
+// The messages are encoded as JSON (content subtype "json", i.e. application/grpc+json), so no code has to be
+// generated. The service shares the roots, the policy and the options with a unpackhttp.TriggerHandler:
+//
+//	trigger := unpackhttp.NewTrigger([]string{"/srv/artifacts"})
+//	s := grpc.NewServer()
+//	unpackgrpc.Register(s, unpackgrpc.NewServer(trigger))
+//
+// and is called with a Client:
+//
+//	conn, err := grpc.NewClient("unpack:9090", grpc.WithTransportCredentials(insecure.NewCredentials()))
+//	res, err := unpackgrpc.NewClient(conn).Unpack(ctx, unpackgrpc.Request{Path: "build/release.tgz"}, func(p unpack.Progress) {
+//		fmt.Printf("%.0f%%\n", p.Percent())
+//	})
+package unpackgrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/metakeule/unpack/unpack.v1"
+	"github.com/metakeule/unpack/unpack.v1/unpackhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the full name of the gRPC service
+const ServiceName = "unpack.Unpacker"
+
+// ProblemKey is the key of the trailer metadata of a failed call with the unpackhttp.Problem as JSON,
+// so that clients get the stable code of the error (see unpack.ErrorCode and the codes of unpackhttp)
+const ProblemKey = "unpack-problem-bin"
+
+// ProgressInterval is the minimal interval between two progress updates of a call
+var ProgressInterval = 200 * time.Millisecond
+
+// Request is the message of a call of Unpack, like the JSON payload of the TriggerHandler
+type Request = unpackhttp.TriggerRequest
+
+// Result is the result of a successful call of Unpack
+type Result = unpackhttp.TriggerResult
+
+// Update is a message of the stream of Unpack. All updates but the last one have the Progress, the last update
+// has the Result.
+type Update struct {
+	Progress *unpack.Progress `json:"progress,omitempty"`
+	Result   *Result          `json:"result,omitempty"`
+}
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// codec encodes the messages as JSON
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (codec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+func (codec) Name() string                               { return "json" }
+
+// Server implements the service with a TriggerHandler.
+type Server struct {
+	trigger *unpackhttp.TriggerHandler
+}
+
+// NewServer returns a Server that checks and unpacks the requests like trigger. The bearer token of the
+// Policy of trigger is taken from the metadata "authorization" of a call.
+func NewServer(trigger *unpackhttp.TriggerHandler) *Server {
+	return &Server{trigger: trigger}
+}
+
+// Register registers the service of srv with s.
+func Register(s *grpc.Server, srv *Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Unpack",
+			Handler:       unpackHandler,
+			ServerStreams: true,
+		},
+	},
+}
+
+func unpackHandler(srv interface{}, stream grpc.ServerStream) error {
+	var req Request
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+	return srv.(*Server).unpack(req, stream)
+}
+
+// unpack unpacks the archive of req and sends the progress and the result to stream
+func (s *Server) unpack(req Request, stream grpc.ServerStream) error {
+	var auth string
+	if md, ok := metadata.FromIncomingContext(stream.Context()); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			auth = v[0]
+		}
+	}
+
+	run, p := s.trigger.Prepare(auth, req)
+	if p != nil {
+		return problemError(stream, p)
+	}
+
+	var (
+		mx   sync.Mutex
+		last time.Time
+	)
+
+	progress := unpack.OnProgress(func(pr unpack.Progress) {
+		mx.Lock()
+		defer mx.Unlock()
+		if time.Since(last) < ProgressInterval {
+			return
+		}
+		last = time.Now()
+		// a client that is gone gets the error of the call
+		stream.SendMsg(&Update{Progress: &pr})
+	})
+
+	res, p := run(progress)
+	if p != nil {
+		return problemError(stream, p)
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	return stream.SendMsg(&Update{Result: res})
+}
+
+// grpcCodes are the codes of the gRPC status by the HTTP status of a Problem
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:            codes.InvalidArgument,
+	http.StatusUnauthorized:          codes.Unauthenticated,
+	http.StatusForbidden:             codes.PermissionDenied,
+	http.StatusNotFound:              codes.NotFound,
+	http.StatusConflict:              codes.AlreadyExists,
+	http.StatusRequestEntityTooLarge: codes.ResourceExhausted,
+	http.StatusUnprocessableEntity:   codes.FailedPrecondition,
+	http.StatusBadGateway:            codes.Unavailable,
+}
+
+// problemError sets p as trailer of stream and returns it as gRPC status
+func problemError(stream grpc.ServerStream, p *unpackhttp.Problem) error {
+	if b, err := json.Marshal(p); err == nil {
+		stream.SetTrailer(metadata.Pairs(ProblemKey, string(b)))
+	}
+
+	c, has := grpcCodes[p.Status]
+	if !has {
+		c = codes.Internal
+	}
+	return status.Error(c, p.Error())
+}
+
+// Client calls the service.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewClient returns a Client that calls the service via cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+// Unpack lets the server unpack the archive of req. progress is called for the progress updates, if it is not nil.
+// If the call fails because of the request or the unpacking, the error is a *unpackhttp.Problem with the
+// stable code of the error, other errors are the errors of gRPC. The bearer token of the Policy of the server
+// is sent as metadata "authorization" of ctx, see metadata.AppendToOutgoingContext.
+func (c *Client) Unpack(ctx context.Context, req Request, progress func(unpack.Progress), opts ...grpc.CallOption) (*Result, error) {
+	// the stream is released when the call returns, even if the server has not finished it after the result
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var trailer metadata.MD
+	opts = append([]grpc.CallOption{grpc.CallContentSubtype("json"), grpc.Trailer(&trailer)}, opts...)
+
+	stream, err := c.cc.NewStream(ctx, &serviceDesc.Streams[0], "/"+ServiceName+"/Unpack", opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.SendMsg(&req)
+	if err == nil {
+		err = stream.CloseSend()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var u Update
+		err = stream.RecvMsg(&u)
+		if err != nil {
+			return nil, clientError(err, trailer)
+		}
+
+		switch {
+		case u.Result != nil:
+			return u.Result, nil
+		case u.Progress != nil && progress != nil:
+			progress(*u.Progress)
+		}
+	}
+}
+
+// clientError returns the Problem of a failed call, if the trailer has one
+func clientError(err error, trailer metadata.MD) error {
+	v := trailer.Get(ProblemKey)
+	if len(v) == 0 {
+		return err
+	}
+
+	var p unpackhttp.Problem
+	if json.Unmarshal([]byte(v[0]), &p) != nil {
+		return err
+	}
+	return &p
+}
@@ -0,0 +1,320 @@
+package unpackhttp
+
+import (
+	"archive/tar"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metakeule/unpack/unpack.v1"
+)
+
+// Status of a job
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// JobStatus is the JSON response of the JobsHandler
+type JobStatus struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+
+	// Archive is the path or URL of a TriggerRequest, Uploads are the results of the uploaded archives
+	Archive string       `json:"archive,omitempty"`
+	Uploads []FileResult `json:"uploads,omitempty"`
+
+	// Dir is the directory that has been created for the unpacked files
+	Dir string `json:"dir,omitempty"`
+
+	// Files are the paths (relative to Dir) of all unpacked files and directories, when the job is done
+	Files []string `json:"files,omitempty"`
+
+	// Problem is the error of a failed job
+	Problem *Problem `json:"problem,omitempty"`
+
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// JobsHandler is a http.Handler that unpacks archives asynchronously, so that clients don't have to keep the
+// connection open while big archives are unpacked:
+//
+//	POST /jobs            a JSON TriggerRequest (handled by Trigger) or a multipart upload (handled by Upload),
+//	                      responds with 202 Accepted, the JobStatus and the Location of the job
+//	GET  /jobs/{id}       the JobStatus, with the list of the unpacked files when the job is done
+//	GET  /jobs/{id}/tar   the unpacked files as streamed tar, when the job is done
+//
+// The jobs are kept in memory for Retention after they have finished.
+type JobsHandler struct {
+	// Prefix is the path that the handler is mounted at
+	Prefix string
+
+	// Trigger handles the references to archives and Upload the uploads
+	Trigger *TriggerHandler
+	Upload  *Handler
+
+	// Retention is the time that finished jobs are kept
+	Retention time.Duration
+
+	slots chan struct{}
+	mx    sync.Mutex
+	jobs  map[string]*JobStatus
+}
+
+// NewJobs returns a JobsHandler that is mounted at /jobs and runs up to workers jobs at the same time (at least 1).
+// Finished jobs are kept for an hour.
+func NewJobs(trigger *TriggerHandler, upload *Handler, workers int) *JobsHandler {
+	if workers < 1 {
+		workers = 1
+	}
+	return &JobsHandler{
+		Prefix:    "/jobs",
+		Trigger:   trigger,
+		Upload:    upload,
+		Retention: time.Hour,
+		slots:     make(chan struct{}, workers),
+		jobs:      map[string]*JobStatus{},
+	}
+}
+
+// ServeHTTP handles the request
+func (h *JobsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, h.Prefix), "/")
+
+	switch {
+	case rest == "":
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeProblem(w, newProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, ""))
+			return
+		}
+		h.submit(w, r)
+	case r.Method != http.MethodGet && r.Method != http.MethodHead:
+		w.Header().Set("Allow", "GET, HEAD")
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, ""))
+	case strings.HasSuffix(rest, "/tar"):
+		h.writeTar(w, strings.TrimSuffix(rest, "/tar"))
+	default:
+		st := h.status(rest)
+		if st == nil {
+			writeProblem(w, newProblem(http.StatusNotFound, unpack.CodeNotFound, "no such job"))
+			return
+		}
+		writeJSON(w, http.StatusOK, st)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// submit reads the request and starts the job
+func (h *JobsHandler) submit(w http.ResponseWriter, r *http.Request) {
+	var run func(st *JobStatus)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		uploads, p := h.Upload.read(w, r)
+		if p != nil {
+			writeProblem(w, p)
+			return
+		}
+		run = func(st *JobStatus) {
+			res, failed := h.Upload.unpackAll(uploads)
+			if res == nil {
+				h.finish(st, "", nil, newProblem(http.StatusInternalServerError, unpack.CodeMkDirFailed, "can't create directory"))
+				return
+			}
+			dir := filepath.Join(h.Upload.Dir, res.ID)
+			h.mx.Lock()
+			st.Uploads = res.Files
+			h.mx.Unlock()
+			if failed != nil {
+				h.finish(st, dir, nil, unpackProblem(failed))
+				return
+			}
+			h.finish(st, dir, res.Entries, nil)
+		}
+	} else {
+		t, p := h.Trigger.parse(w, r)
+		if p != nil {
+			writeProblem(w, p)
+			return
+		}
+		run = func(st *JobStatus) {
+			res, err := t.run()
+			if err != nil {
+				h.finish(st, res.Dir, nil, unpackProblem(err))
+				return
+			}
+			h.finish(st, res.Dir, entries(res.Dir), nil)
+		}
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		writeProblem(w, newProblem(http.StatusInternalServerError, unpack.CodeInternal, err.Error()))
+		return
+	}
+
+	st := &JobStatus{ID: id, Status: JobQueued, Created: time.Now()}
+
+	h.mx.Lock()
+	h.purge()
+	h.jobs[id] = st
+	res := *st
+	h.mx.Unlock()
+
+	go func() {
+		h.slots <- struct{}{}
+		defer func() { <-h.slots }()
+
+		h.mx.Lock()
+		st.Status = JobRunning
+		h.mx.Unlock()
+		run(st)
+	}()
+
+	w.Header().Set("Location", path.Join(h.Prefix, id))
+	writeJSON(w, http.StatusAccepted, res)
+}
+
+// finish sets the result of the job
+func (h *JobsHandler) finish(st *JobStatus, dir string, files []string, p *Problem) {
+	now := time.Now()
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	st.Dir, st.Files, st.Problem, st.Finished = dir, files, p, &now
+	if p != nil {
+		st.Status = JobFailed
+		return
+	}
+	st.Status = JobDone
+}
+
+// status returns a copy of the status of the job with the given id or nil, if there is none
+func (h *JobsHandler) status(id string) *JobStatus {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.purge()
+	st := h.jobs[id]
+	if st == nil {
+		return nil
+	}
+	c := *st
+	return &c
+}
+
+// purge removes the jobs that have finished before the Retention, h.mx must be held
+func (h *JobsHandler) purge() {
+	for id, st := range h.jobs {
+		if st.Finished != nil && time.Since(*st.Finished) > h.Retention {
+			delete(h.jobs, id)
+		}
+	}
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// writeTar streams the unpacked files of the job as tar
+func (h *JobsHandler) writeTar(w http.ResponseWriter, id string) {
+	st := h.status(id)
+	switch {
+	case st == nil:
+		writeProblem(w, newProblem(http.StatusNotFound, unpack.CodeNotFound, "no such job"))
+		return
+	case st.Status != JobDone:
+		writeProblem(w, newProblem(http.StatusConflict, CodeJobNotDone, "the job is "+st.Status))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(st.Dir) + ".tar"}))
+
+	// the status has been sent already, errors can only cut the stream
+	writeTree(w, st.Dir)
+}
+
+// writeTree writes the files, directories and symlinks inside dir as tar to w
+func writeTree(w io.Writer, dir string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == dir {
+			return err
+		}
+
+		finfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if finfo.Mode()&fs.ModeSymlink != 0 {
+			link, err = os.Readlink(p)
+			if err != nil {
+				return err
+			}
+		} else if !finfo.Mode().IsRegular() && !finfo.IsDir() {
+			return nil
+		}
+
+		hdr, err := tar.FileInfoHeader(finfo, link)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if finfo.IsDir() {
+			hdr.Name += "/"
+		}
+
+		err = tw.WriteHeader(hdr)
+		if err != nil || !finfo.Mode().IsRegular() {
+			return err
+		}
+
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
@@ -0,0 +1,124 @@
+package unpackhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policy restricts what the callers of a TriggerHandler may ask for, depending on their role, so that the
+// service can be exposed to semi-trusted clients. The role of a request is found by its bearer token
+// (header "Authorization: Bearer <token>").
+type Policy struct {
+	// Tokens maps the bearer tokens to the names of the roles
+	Tokens map[string]string `json:"tokens"`
+
+	// Roles are the permissions by the name of the role
+	Roles map[string]Role `json:"roles"`
+
+	// DefaultRole is the role of requests without a token. If it is empty, these requests are refused.
+	DefaultRole string `json:"default_role,omitempty"`
+}
+
+// Role is the set of permissions of a role
+type Role struct {
+	// Options are the JSON names of the TriggerOptions that may be set, e.g. "test" or "remove_archive"
+	Options []string `json:"options"`
+
+	// URL allows to unpack archives from URLs
+	URL bool `json:"url,omitempty"`
+
+	// AbsolutePaths allows absolute paths and dirs (inside of the roots), otherwise they must be relative to the first root
+	AbsolutePaths bool `json:"absolute_paths,omitempty"`
+}
+
+// LoadPolicy reads a Policy from the given JSON file, e.g.
+//
+//	{
+//	  "tokens": {"s3cr3t": "ci"},
+//	  "roles": {
+//	    "ci": {"options": ["test", "remove_archive"], "url": true},
+//	    "guest": {"options": ["test"]}
+//	  },
+//	  "default_role": "guest"
+//	}
+func LoadPolicy(file string) (*Policy, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	err = json.Unmarshal(b, &p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %#v: %v", file, err)
+	}
+
+	for token, role := range p.Tokens {
+		if _, has := p.Roles[role]; !has {
+			return nil, fmt.Errorf("invalid policy %#v: unknown role %#v of token %#v", file, role, token)
+		}
+	}
+
+	if _, has := p.Roles[p.DefaultRole]; p.DefaultRole != "" && !has {
+		return nil, fmt.Errorf("invalid policy %#v: unknown default role %#v", file, p.DefaultRole)
+	}
+
+	return &p, nil
+}
+
+// role returns the role of a request with the given value of the Authorization header and false, if the request
+// has no valid role
+func (p *Policy) role(auth string) (Role, bool) {
+	name := p.DefaultRole
+
+	if auth != "" {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if token == auth {
+			return Role{}, false
+		}
+
+		var has bool
+		name, has = p.Tokens[token]
+		if !has {
+			return Role{}, false
+		}
+	}
+
+	if name == "" {
+		return Role{}, false
+	}
+
+	role, has := p.Roles[name]
+	return role, has
+}
+
+// check returns an error, if the role is not allowed to send the request
+func (ro Role) check(req *TriggerRequest) error {
+	if req.URL != "" && !ro.URL {
+		return fmt.Errorf("urls are not allowed")
+	}
+
+	if !ro.AbsolutePaths && (filepath.IsAbs(req.Path) || filepath.IsAbs(req.Dir)) {
+		return fmt.Errorf("absolute paths are not allowed")
+	}
+
+	for _, opt := range req.Options.set() {
+		if !ro.allows(opt) {
+			return fmt.Errorf("option %#v is not allowed", opt)
+		}
+	}
+
+	return nil
+}
+
+func (ro Role) allows(opt string) bool {
+	for _, o := range ro.Options {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package unpackhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/metakeule/unpack/unpack.v1"
+)
+
+// Stable codes of the errors of the requests themselves. The errors of the unpacking have the codes
+// of unpack.ErrorCode.
+const (
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInvalidRequest   = "invalid_request"
+	CodeRequestTooLarge  = "request_too_large"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeJobNotDone       = "job_not_done"
+)
+
+// ProblemType is the prefix of the type of a Problem, the code is appended
+const ProblemType = "urn:unpack:error:"
+
+// Problem is the RFC 7807 (application/problem+json) response of the handlers if a request fails.
+// Code is a stable identifier of the class of the error, so that clients may decide about retries
+// and messages to the user without parsing Detail.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code"`
+
+	// Archive is the archive of a TriggerRequest
+	Archive string `json:"archive,omitempty"`
+
+	// ID, Files and Entries are set for uploads like inside a Result
+	ID      string       `json:"id,omitempty"`
+	Files   []FileResult `json:"files,omitempty"`
+	Entries []string     `json:"entries,omitempty"`
+}
+
+var titles = map[string]string{
+	CodeMethodNotAllowed:        "Method not allowed",
+	CodeInvalidRequest:          "Invalid request",
+	CodeRequestTooLarge:         "Request too large",
+	CodeUnauthorized:            "Unauthorized",
+	CodeForbidden:               "Forbidden",
+	CodeJobNotDone:              "Job not done",
+	unpack.CodeNoExtension:      "Archive has no extension",
+	unpack.CodeUnknownFormat:    "Unknown archive format",
+	unpack.CodeCorruptArchive:   "Corrupt archive",
+	unpack.CodeCommandFailed:    "Unpacker failed",
+	unpack.CodeNoExec:           "Unpacker not available",
+	unpack.CodeIllegalPath:      "Illegal path inside archive",
+	unpack.CodeLongPath:         "Path too long",
+	unpack.CodeLimitExceeded:    "Limit exceeded",
+	unpack.CodeTimeout:          "Unpacking timed out",
+	unpack.CodeMissingVolume:    "Missing volume",
+	unpack.CodeClassMismatch:    "Unexpected output of unpacker",
+	unpack.CodeExists:           "Directory exists",
+	unpack.CodeProtectedDir:     "Protected directory",
+	unpack.CodeMkDirFailed:      "Could not create directory",
+	unpack.CodeDownloadFailed:   "Download failed",
+	unpack.CodeUnknownSource:    "Unknown URL scheme",
+	unpack.CodeNotFound:         "Not found",
+	unpack.CodePermission:       "Permission denied",
+	unpack.CodeInvalidSchedule:  "Invalid schedule",
+	unpack.CodeInvalidTemplate:  "Invalid dir template",
+	unpack.CodeChecksumMismatch: "Checksum mismatch",
+	unpack.CodeBadSignature:     "Bad signature",
+	unpack.CodeInternal:         "Internal error",
+}
+
+// statusOf returns the HTTP status for an error of the unpacking
+func statusOf(code string) int {
+	switch code {
+	case unpack.CodeNotFound:
+		return http.StatusNotFound
+	case unpack.CodeExists:
+		return http.StatusConflict
+	case unpack.CodeProtectedDir:
+		return http.StatusForbidden
+	case unpack.CodeUnknownSource:
+		return http.StatusBadRequest
+	case unpack.CodeDownloadFailed:
+		return http.StatusBadGateway
+	case unpack.CodeNoExec, unpack.CodeMkDirFailed, unpack.CodePermission, unpack.CodeInvalidTemplate, unpack.CodeInternal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusUnprocessableEntity
+	}
+}
+
+// newProblem returns a Problem with the given status, code and detail
+func newProblem(status int, code string, detail string) *Problem {
+	return &Problem{
+		Type:   ProblemType + code,
+		Title:  titles[code],
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// unpackProblem returns the Problem for an error of the unpacking
+func unpackProblem(err error) *Problem {
+	code := unpack.ErrorCode(err)
+	return newProblem(statusOf(code), code, err.Error())
+}
+
+func writeProblem(w http.ResponseWriter, p *Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Error returns the detail of the Problem (or its title, if there is no detail), so that the
+// Problem can be returned as error by clients
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
@@ -0,0 +1,356 @@
+package unpackhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/metakeule/unpack/unpack.v1"
+)
+
+// maximal depths of chained and nested archives that a request may ask for
+const (
+	maxTriggerChain  = 5
+	maxTriggerNested = 5
+)
+
+// TriggerHandler is a http.Handler that unpacks an archive which is already on the server (or at an URL)
+// when it receives a JSON TriggerRequest (POST), e.g. sent by a download manager or a CI system that has finished
+// an artifact. It responds with a JSON TriggerResult or, if the request fails, with a Problem.
+// Only archives and directories inside of Roots are accepted.
+type TriggerHandler struct {
+	// Roots are the directories inside of which archives are unpacked. Relative paths of a request
+	// are relative to the first root.
+	Roots []string
+
+	// MaxRequestSize is the maximal size of the request body in bytes
+	MaxRequestSize int64
+
+	// Policy restricts the requests by the role of the caller. If it is nil, every request is allowed.
+	Policy *Policy
+
+	opts []unpack.Option
+}
+
+// NewTrigger returns a TriggerHandler for the given roots. The unpacker is configured with the same defaults as
+// by New, the given opts are applied afterwards and the options of a request at last. The options of a request
+// can't loosen the limits. The maximal request size defaults to 64K.
+func NewTrigger(roots []string, opts ...unpack.Option) *TriggerHandler {
+	return &TriggerHandler{
+		Roots:          roots,
+		MaxRequestSize: 64 << 10,
+		opts:           append(defaults(), opts...),
+	}
+}
+
+// TriggerRequest is the JSON payload of a request to the TriggerHandler. Either Path or URL must be set.
+type TriggerRequest struct {
+	// Path is the archive file that is unpacked into a subdirectory of its directory
+	Path string `json:"path,omitempty"`
+
+	// URL is the archive that is downloaded and unpacked into a subdirectory of Dir
+	URL string `json:"url,omitempty"`
+
+	// Dir is the directory for URL, it defaults to the first root
+	Dir string `json:"dir,omitempty"`
+
+	Options TriggerOptions `json:"options"`
+}
+
+// TriggerOptions are the options of a single TriggerRequest
+type TriggerOptions struct {
+	// RemoveArchive removes the archive after it has been unpacked successfully
+	RemoveArchive bool `json:"remove_archive,omitempty"`
+
+	// Test tests the archive before it is unpacked
+	Test bool `json:"test,omitempty"`
+
+	// Symlinks is "skip" (the default) or "relative"
+	Symlinks string `json:"symlinks,omitempty"`
+
+	// Reproducible sets the modification times of the unpacked files to a fixed time
+	Reproducible bool `json:"reproducible,omitempty"`
+
+	// Chain is the depth of chained archives (like .tar.gz.gpg) that are unpacked, at most 5
+	Chain int `json:"chain,omitempty"`
+
+	// NestedDepth is the depth of archives inside the archive that are unpacked, at most 5
+	NestedDepth int `json:"nested_depth,omitempty"`
+
+	// KeepDownload keeps the downloaded archive of an URL
+	KeepDownload bool `json:"keep_download,omitempty"`
+}
+
+// set returns the JSON names of the options that are set
+func (o TriggerOptions) set() (names []string) {
+	for name, isSet := range map[string]bool{
+		"remove_archive": o.RemoveArchive,
+		"test":           o.Test,
+		"symlinks":       o.Symlinks != "",
+		"reproducible":   o.Reproducible,
+		"chain":          o.Chain != 0,
+		"nested_depth":   o.NestedDepth != 0,
+		"keep_download":  o.KeepDownload,
+	} {
+		if isSet {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return
+}
+
+// options returns the unpack options of the request
+func (o TriggerOptions) options() ([]unpack.Option, error) {
+	var opts []unpack.Option
+
+	switch o.Symlinks {
+	case "", "skip":
+	case "relative":
+		opts = append(opts, unpack.Symlinks(unpack.SymlinksRelativeOnly))
+	default:
+		return nil, fmt.Errorf("symlinks must be \"skip\" or \"relative\", not %#v", o.Symlinks)
+	}
+
+	if o.Chain < 0 || o.Chain > maxTriggerChain {
+		return nil, fmt.Errorf("chain must be between 0 and %d", maxTriggerChain)
+	}
+
+	if o.NestedDepth < 0 || o.NestedDepth > maxTriggerNested {
+		return nil, fmt.Errorf("nested_depth must be between 0 and %d", maxTriggerNested)
+	}
+
+	if o.RemoveArchive {
+		opts = append(opts, unpack.RemoveArchive)
+	}
+	if o.Test {
+		opts = append(opts, unpack.TestBeforeUnpack)
+	}
+	if o.Reproducible {
+		opts = append(opts, unpack.Reproducible)
+	}
+	if o.Chain > 0 {
+		opts = append(opts, unpack.Chain(o.Chain))
+	}
+	if o.NestedDepth > 0 {
+		opts = append(opts, unpack.NestedDepth(o.NestedDepth))
+	}
+	if o.KeepDownload {
+		opts = append(opts, unpack.KeepDownload)
+	}
+
+	return opts, nil
+}
+
+// TriggerResult is the JSON response of the TriggerHandler
+type TriggerResult struct {
+	// Archive is the unpacked path or URL
+	Archive string `json:"archive,omitempty"`
+
+	// Dir is the directory that has been created for the unpacked files
+	Dir string `json:"dir,omitempty"`
+}
+
+// allowed returns the real path of p (relative paths are relative to the first root), if it is inside one of the roots
+func (h *TriggerHandler) allowed(p string) (string, error) {
+	if len(h.Roots) == 0 {
+		return "", fmt.Errorf("no roots configured")
+	}
+
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(h.Roots[0], p)
+	}
+
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+
+	real, err = filepath.Abs(real)
+	if err != nil {
+		return "", err
+	}
+
+	for _, root := range h.Roots {
+		r, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		r, err = filepath.Abs(r)
+		if err != nil {
+			continue
+		}
+
+		rel, err := filepath.Rel(r, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return real, nil
+		}
+	}
+
+	return "", errForbidden
+}
+
+var errForbidden = fmt.Errorf("path is not inside of the allowed roots")
+
+// ServeHTTP handles the request
+func (h *TriggerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, ""))
+		return
+	}
+
+	t, p := h.parse(w, r)
+	if p != nil {
+		writeProblem(w, p)
+		return
+	}
+
+	res, err := t.run()
+	if err != nil {
+		p = unpackProblem(err)
+		p.Archive = res.Archive
+		writeProblem(w, p)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(res)
+}
+
+// trigger is the unpacking that has been requested by a valid TriggerRequest
+type trigger struct {
+	req    TriggerRequest
+	target string
+	opts   []unpack.Option
+}
+
+// parse reads and checks the TriggerRequest of r. If it is not valid, the Problem of the response is returned.
+func (h *TriggerHandler) parse(w http.ResponseWriter, r *http.Request) (*trigger, *Problem) {
+	auth := r.Header.Get("Authorization")
+	if h.Policy != nil {
+		if _, ok := h.Policy.role(auth); !ok {
+			return nil, newProblem(http.StatusUnauthorized, CodeUnauthorized, "")
+		}
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxRequestSize)
+
+	var req TriggerRequest
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(&req)
+	if err != nil {
+		if _, tooLarge := err.(*http.MaxBytesError); tooLarge {
+			return nil, newProblem(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, err.Error())
+		}
+		return nil, newProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+
+	return h.check(auth, req)
+}
+
+// Prepare checks req like ServeHTTP, for a caller with the given value of the Authorization header (see Policy),
+// so that other transports (like the unpackgrpc package) share the roots, the policy and the options of h.
+// If req is valid, the returned run function unpacks its archive with the additional opts, e.g. to report
+// the progress, and returns the Problem of a failure, otherwise the Problem of req is returned.
+func (h *TriggerHandler) Prepare(auth string, req TriggerRequest) (run func(opts ...unpack.Option) (*TriggerResult, *Problem), p *Problem) {
+	t, p := h.check(auth, req)
+	if p != nil {
+		return nil, p
+	}
+	return func(opts ...unpack.Option) (*TriggerResult, *Problem) {
+		res, err := t.run(opts...)
+		if err != nil {
+			p := unpackProblem(err)
+			p.Archive = res.Archive
+			return nil, p
+		}
+		return res, nil
+	}, nil
+}
+
+// check checks req of a caller with the given value of the Authorization header
+func (h *TriggerHandler) check(auth string, req TriggerRequest) (*trigger, *Problem) {
+	var role Role
+	if h.Policy != nil {
+		var ok bool
+		role, ok = h.Policy.role(auth)
+		if !ok {
+			return nil, newProblem(http.StatusUnauthorized, CodeUnauthorized, "")
+		}
+	}
+
+	fail := func(p *Problem) (*trigger, *Problem) {
+		p.Archive = req.Path
+		if req.URL != "" {
+			p.Archive = req.URL
+		}
+		return nil, p
+	}
+
+	if (req.Path == "") == (req.URL == "") {
+		return fail(newProblem(http.StatusBadRequest, CodeInvalidRequest, "either path or url must be given"))
+	}
+
+	if h.Policy != nil {
+		err := role.check(&req)
+		if err != nil {
+			return fail(newProblem(http.StatusForbidden, CodeForbidden, err.Error()))
+		}
+	}
+
+	opts, err := req.Options.options()
+	if err != nil {
+		return fail(newProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+	}
+
+	target := req.Path
+	if req.URL != "" {
+		target = req.Dir
+		if target == "" && len(h.Roots) > 0 {
+			target = h.Roots[0]
+		}
+	}
+
+	target, err = h.allowed(target)
+	switch {
+	case err == errForbidden:
+		return fail(newProblem(http.StatusForbidden, CodeForbidden, err.Error()))
+	case os.IsNotExist(err):
+		return fail(newProblem(http.StatusNotFound, unpack.CodeNotFound, "no such file or directory"))
+	case err != nil:
+		return fail(newProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error()))
+	}
+
+	return &trigger{req: req, target: target, opts: append(h.opts[:len(h.opts):len(h.opts)], opts...)}, nil
+}
+
+// run unpacks the archive of the request with the additional opts
+func (t *trigger) run(opts ...unpack.Option) (*TriggerResult, error) {
+	res := &TriggerResult{Archive: t.req.Path}
+	if t.req.URL != "" {
+		res.Archive = t.req.URL
+	}
+
+	opts = append(append(t.opts[:len(t.opts):len(t.opts)], opts...), unpack.OnDone(func(j unpack.Job) {
+		if j.Dir != "" {
+			res.Dir = j.Dir
+		}
+	}))
+
+	u := unpack.New(opts...)
+
+	var err error
+	if t.req.URL != "" {
+		err = u.UnpackURL(t.req.URL, t.target)
+	} else {
+		err = u.UnpackFile(t.target)
+	}
+	return res, err
+}
@@ -0,0 +1,233 @@
+// Package unpackhttp provides a http.Handler that unpacks archives uploaded via multipart forms.
+package unpackhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/metakeule/unpack/unpack.v1"
+)
+
+// Handler is a http.Handler that accepts multipart uploads (POST) of one or more archives in the
+// form field Field, unpacks them into a new subdirectory of Dir and responds with a JSON Result or,
+// if the request or the unpacking of an archive fails, with a Problem.
+type Handler struct {
+	// Dir is the directory inside of which each request gets its own subdirectory
+	Dir string
+
+	// Field is the name of the form field that contains the archives
+	Field string
+
+	// MaxUploadSize is the maximal size of the request body in bytes
+	MaxUploadSize int64
+
+	unpacker interface {
+		UnpackBytes(data []byte, name string, dir string) error
+	}
+}
+
+// New returns a Handler that unpacks into subdirectories of dir. The unpacker is configured with
+// the native backend, SymlinksSkip, a maximal extracted size of 1G, a maximal file count of 10000,
+// a maximal compression ratio of 100 and a decoder memory limit of 256M. The given opts are applied afterwards,
+// so they may override these.
+// The form field defaults to "file" and the maximal upload size to 32M.
+func New(dir string, opts ...unpack.Option) *Handler {
+	return &Handler{
+		Dir:           dir,
+		Field:         "file",
+		MaxUploadSize: 32 << 20,
+		unpacker:      unpack.New(append(defaults(), opts...)...),
+	}
+}
+
+// defaults are the options that are safe for archives of untrusted origin
+func defaults() []unpack.Option {
+	return []unpack.Option{
+		unpack.Native,
+		unpack.Symlinks(unpack.SymlinksSkip),
+		unpack.MaxExtractedSize(1 << 30),
+		unpack.MaxFileCount(10000),
+		unpack.MaxCompressionRatio(100),
+		unpack.DecoderMemoryLimit(256 << 20),
+	}
+}
+
+// Result is the JSON response of the Handler
+type Result struct {
+	// ID is the name of the subdirectory of Handler.Dir that has been created for the request
+	ID string `json:"id,omitempty"`
+
+	// Files has an entry for every uploaded archive
+	Files []FileResult `json:"files,omitempty"`
+
+	// Entries are the paths (relative to the subdirectory) of all unpacked files and directories
+	Entries []string `json:"entries,omitempty"`
+
+	// Error is set if the request could not be handled at all.
+	// Deprecated: failed requests are answered with a Problem.
+	Error string `json:"error,omitempty"`
+}
+
+// FileResult is the result for a single uploaded archive
+type FileResult struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+
+	// Code is the stable code of the error, see unpack.ErrorCode
+	Code string `json:"code,omitempty"`
+}
+
+// sanitizeName returns the base of the filename as sent by the client, which may contain
+// paths of any operating system
+func sanitizeName(name string) (string, error) {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == ".." || strings.ContainsRune(name, 0) {
+		return "", fmt.Errorf("invalid file name: %#v", name)
+	}
+
+	return name, nil
+}
+
+func (h *Handler) respond(w http.ResponseWriter, status int, res *Result) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// ServeHTTP handles the upload
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeProblem(w, newProblem(http.StatusMethodNotAllowed, CodeMethodNotAllowed, ""))
+		return
+	}
+
+	uploads, p := h.read(w, r)
+	if p != nil {
+		writeProblem(w, p)
+		return
+	}
+
+	res, failed := h.unpackAll(uploads)
+	if res == nil {
+		writeProblem(w, newProblem(http.StatusInternalServerError, unpack.CodeMkDirFailed, "can't create directory"))
+		return
+	}
+
+	if failed != nil {
+		p := unpackProblem(failed)
+		p.ID, p.Files, p.Entries = res.ID, res.Files, res.Entries
+		writeProblem(w, p)
+		return
+	}
+
+	h.respond(w, http.StatusOK, res)
+}
+
+// upload is an archive of a request to the Handler
+type upload struct {
+	// name is the file name as sent by the client
+	name string
+	data []byte
+	err  error
+}
+
+// read reads the uploaded archives of r. If the request is not valid, the Problem of the response is returned.
+func (h *Handler) read(w http.ResponseWriter, r *http.Request) ([]upload, *Problem) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.MaxUploadSize)
+
+	err := r.ParseMultipartForm(h.MaxUploadSize)
+	if err != nil {
+		if _, tooLarge := err.(*http.MaxBytesError); tooLarge {
+			return nil, newProblem(http.StatusRequestEntityTooLarge, CodeRequestTooLarge, err.Error())
+		}
+		return nil, newProblem(http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File[h.Field]
+	if len(headers) == 0 {
+		return nil, newProblem(http.StatusBadRequest, CodeInvalidRequest, fmt.Sprintf("missing form field %#v", h.Field))
+	}
+
+	var uploads []upload
+	for _, hd := range headers {
+		up := upload{name: hd.Filename}
+		up.data, up.err = readFile(hd)
+		uploads = append(uploads, up)
+	}
+	return uploads, nil
+}
+
+func readFile(hd *multipart.FileHeader) ([]byte, error) {
+	f, err := hd.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// unpackAll unpacks the uploads into a new subdirectory of h.Dir and returns the Result and the first error
+// of the uploads. The Result is nil, if the subdirectory could not be created.
+func (h *Handler) unpackAll(uploads []upload) (res *Result, failed error) {
+	dir, err := os.MkdirTemp(h.Dir, "upload-")
+	if err != nil {
+		return nil, err
+	}
+
+	res = &Result{ID: filepath.Base(dir)}
+
+	for _, up := range uploads {
+		fr := FileResult{Name: up.name}
+		err = h.unpack(up, dir)
+		if err != nil {
+			fr.Error = err.Error()
+			fr.Code = unpack.ErrorCode(err)
+			if failed == nil {
+				failed = err
+			}
+		}
+		res.Files = append(res.Files, fr)
+	}
+
+	res.Entries = entries(dir)
+	return res, failed
+}
+
+// entries returns the slash separated paths of all files and directories inside dir
+func entries(dir string) (paths []string) {
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err == nil && p != dir {
+			rel, _ := filepath.Rel(dir, p)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return
+}
+
+func (h *Handler) unpack(up upload, dir string) error {
+	name, err := sanitizeName(up.name)
+	if err != nil {
+		return err
+	}
+
+	if up.err != nil {
+		return up.err
+	}
+
+	return h.unpacker.UnpackBytes(up.data, name, dir)
+}
@@ -0,0 +1,27 @@
+// Package unpacktest simulates failures of the external commands that unpack runs, so that the handling of
+// broken tools, partial output, hangs and strange exit codes (like RestoreOnError or the limits) can be
+// exercised deterministically in tests, without real broken archives or tools.
+//
+//	restore := unpacktest.InjectFaults(unpacktest.Fault{Match: "^unrar ", ExitCode: 3, Files: map[string]string{"a.txt": "par"}})
+//	defer restore()
+//
+// The faults affect all unpackers of the process, so tests that inject them must not run in parallel.
+// The native backend is not affected.
+package unpacktest
+
+import (
+	"lib"
+)
+
+// Fault is a simulated failure of an external command, see InjectFaults.
+// Failures are returned as errors with the code CodeCommandFailed (see unpack.ErrorCode).
+type Fault = lib.Fault
+
+// FaultError is the error of a command that failed with the ExitCode of a Fault.
+type FaultError = lib.FaultError
+
+// InjectFaults makes the external commands fail as given by the first matching of the faults instead of running
+// them, until restore is called. It panics, if a Match is not a valid regular expression.
+func InjectFaults(faults ...Fault) (restore func()) {
+	return lib.InjectFaults(faults...)
+}
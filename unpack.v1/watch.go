@@ -0,0 +1,154 @@
+package unpack
+
+import (
+	"context"
+	"lib"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher unpacks the archives that appear inside of directories, e.g. inside ~/Downloads, as soon as they are
+// complete. Other than the Daemon it is driven by filesystem events, so it reacts at once, but it does not work on
+// network mounts that don't deliver them. Archives that exist before the Watcher runs are left alone.
+type Watcher struct {
+	// Dirs are the directories that are watched (not recursively)
+	Dirs []string
+
+	// Pattern is a regular expression, if it is not empty, only the matching files are unpacked
+	Pattern string
+
+	// StableFor is the time that the size and the modification time of a new file must not change before it is
+	// unpacked, so that files that are still written (e.g. downloaded) are not touched
+	StableFor time.Duration
+
+	// Report is called with the error of each archive that could not be unpacked
+	Report func(errs map[string]error)
+
+	// Queue is optional. If it is set, the archives are unpacked as Bulk jobs of the queue (with the
+	// options of the queue), so that the Interactive jobs of the same queue jump ahead of them.
+	Queue *Queue
+
+	unpacker *config
+}
+
+// NewWatcher returns a Watcher that watches dirs and unpacks the new archives inside of them with the
+// given options (see New). A file is unpacked after its size has not changed for two seconds, see StableFor.
+func NewWatcher(dirs []string, opts ...Option) *Watcher {
+	return &Watcher{Dirs: dirs, StableFor: 2 * time.Second, unpacker: New(opts...).(*config)}
+}
+
+// fileState is the state of a file that is not stable yet
+type fileState struct {
+	size  int64
+	mod   time.Time
+	since time.Time
+}
+
+// Run watches the directories and unpacks the new archives until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	accept := isArchive
+	if w.Pattern != "" {
+		r, err := regexp.Compile(w.Pattern)
+		if err != nil {
+			return err
+		}
+		accept = func(path string) bool {
+			return r.MatchString(filepath.Base(path))
+		}
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+
+	for _, dir := range w.Dirs {
+		err = fw.Add(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	interval := w.StableFor / 2
+	if interval <= 0 {
+		interval = 100 * time.Millisecond
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	pending := map[string]fileState{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-fw.Errors:
+			return err
+		case ev := <-fw.Events:
+			switch {
+			case ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename):
+				delete(pending, ev.Name)
+			case ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write):
+				if accept(ev.Name) && !lib.IsOwn(ev.Name) {
+					// the state is taken at the next tick
+					pending[ev.Name] = fileState{}
+				}
+			}
+		case now := <-tick.C:
+			for file, st := range pending {
+				if !w.stable(file, &st, now) {
+					pending[file] = st
+					continue
+				}
+				delete(pending, file)
+				w.unpack(file)
+			}
+		}
+	}
+}
+
+// stable updates the state of the file and returns true, if the file has not changed for StableFor.
+// Files that are gone or no regular files are stable, so that unpack skips them.
+func (w *Watcher) stable(file string, st *fileState, now time.Time) bool {
+	finfo, err := os.Stat(file)
+	if err != nil || !finfo.Mode().IsRegular() {
+		return true
+	}
+
+	if st.since.IsZero() || finfo.Size() != st.size || !finfo.ModTime().Equal(st.mod) {
+		*st = fileState{size: finfo.Size(), mod: finfo.ModTime(), since: now}
+		return false
+	}
+	return now.Sub(st.since) >= w.StableFor
+}
+
+// unpack unpacks the stable file, if it still exists and is not a following volume of a multi-part archive
+func (w *Watcher) unpack(file string) {
+	if !exists(file) || lib.IsFollowingVolume(filepath.Dir(file), filepath.Base(file)) {
+		return
+	}
+
+	if w.Queue != nil {
+		// the queue may retry the job later, so the events are not blocked by it
+		done := w.Queue.Submit(file, Bulk)
+		go func() {
+			w.report(file, <-done)
+		}()
+		return
+	}
+
+	err := w.unpacker.UnpackFile(file)
+	w.unpacker.ReleaseResources()
+	w.report(file, err)
+}
+
+func (w *Watcher) report(file string, err error) {
+	if err != nil && w.Report != nil {
+		w.Report(map[string]error{file: err})
+	}
+}